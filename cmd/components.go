@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/handlers"
+	"github.com/liukaku/discord-tp/cmd/health"
+	"github.com/liukaku/discord-tp/cmd/lifecycle"
+)
+
+const (
+	// deliveryQueueSize is how many messages can wait to be sent to Discord
+	deliveryQueueSize = 100
+	// queueStallThreshold is how long the queue can go without sending
+	// anything while messages wait before it counts as wedged
+	queueStallThreshold = 2 * time.Minute
+	// healthCheckTimeout bounds every readiness check
+	healthCheckTimeout = 5 * time.Second
+)
+
+// discordComponent opens the gateway and keeps the registered commands up to date.
+func discordComponent(cfg *config.Config) lifecycle.Component {
+	return lifecycle.Component{
+		Name: "discord session",
+		Start: func(ctx context.Context) error {
+			if err := discord.Open(); err != nil {
+				return fmt.Errorf("error opening Discord session: %w", err)
+			}
+
+			if cfg.SyncCommands {
+				plan, err := handlers.SyncCommands(discord, discord.State.User.ID, cfg.GuildID, router.ApplicationCommands(), false)
+				if err != nil {
+					// The commands registered last time keep working
+					slog.Error("cannot sync commands", "error", err)
+					return nil
+				}
+				slog.Info("commands synced", "created", len(plan.Create), "updated", len(plan.Update), "deleted", len(plan.Delete), "unchanged", len(plan.Unchanged))
+			}
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if cfg.RemoveCommands {
+				slog.Info("removing commands")
+				// An empty list rather than nil, which is sent as null
+				_, err := handlers.SyncCommands(discord, discord.State.User.ID, cfg.GuildID, []*discordgo.ApplicationCommand{}, false)
+				if err != nil {
+					slog.Error("cannot remove commands", "error", err)
+				}
+			}
+			return discord.Close()
+		},
+	}
+}
+
+// stateComponent saves the state's changes every saveInterval, and those
+// left on shutdown once everything that changes the state has stopped.
+func stateComponent(state *SharedState) lifecycle.Component {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	return lifecycle.Component{
+		Name: "state",
+		Start: func(ctx context.Context) error {
+			go func() {
+				defer close(done)
+				ticker := time.NewTicker(saveInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+						if err := state.flush(); err != nil {
+							// The changes are saved on a later tick instead
+							slog.Error("cannot save state", "error", err)
+						}
+					}
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			close(stop)
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return state.flush()
+		},
+	}
+}
+
+// httpComponent listens straight away, so a port that's in use stops the
+// bot from starting, and serves in the background until shut down.
+func httpComponent(app *lifecycle.Manager, srv *http.Server) lifecycle.Component {
+	return lifecycle.Component{
+		Name: "http server",
+		Start: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return err
+			}
+
+			go func() {
+				err := srv.Serve(listener)
+				if err != nil && !errors.Is(err, http.ErrServerClosed) {
+					app.Fail(fmt.Errorf("http server stopped: %w", err))
+				}
+			}()
+			return nil
+		},
+		Stop: srv.Shutdown,
+	}
+}
+
+// readinessComponent is stopped first on shutdown. It reports not ready for
+// drainDelay so load balancers stop sending traffic before the HTTP server
+// stops taking it.
+func readinessComponent(checker *health.Checker, drainDelay time.Duration) lifecycle.Component {
+	return lifecycle.Component{
+		Name: "readiness",
+		Start: func(ctx context.Context) error {
+			checker.SetDraining(false)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			checker.SetDraining(true)
+			select {
+			case <-time.After(drainDelay):
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	}
+}
+
+// channelGuildID looks up which guild a channel belongs to in the gateway's
+// cache, returning "" if it isn't known.
+func channelGuildID(channelID string) string {
+	channel, err := discord.State.Channel(channelID)
+	if err != nil {
+		return ""
+	}
+	return channel.GuildID
+}
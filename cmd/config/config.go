@@ -0,0 +1,411 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the bot and its HTTP server need.
+//
+// Values are resolved from, lowest to highest precedence: the defaults, an
+// optional YAML or TOML file, the environment (including a .env file) and
+// finally command line flags.
+type Config struct {
+	DiscordToken  string `yaml:"discord_token" toml:"discord_token"`
+	GuildID       string `yaml:"guild_id" toml:"guild_id"`
+	ClientID      string `yaml:"client_id" toml:"client_id"`
+	ListenAddr    string `yaml:"listen_addr" toml:"listen_addr"`
+	PublicURL     string `yaml:"public_url" toml:"public_url"`
+	Environment   string `yaml:"environment" toml:"environment"`
+	AuthURL       string `yaml:"auth_url" toml:"auth_url"`
+	APIURL        string `yaml:"api_url" toml:"api_url"`
+	SiteURL       string `yaml:"site_url" toml:"site_url"`
+	WebhookOrigin string `yaml:"webhook_origin" toml:"webhook_origin"`
+	// WebhookSecret is the password in the webhook URL registered with Trustpilot
+	WebhookSecret string `yaml:"webhook_secret" toml:"webhook_secret"`
+	// AllowUnauthenticatedWebhooks accepts webhooks without a secret, for local testing
+	AllowUnauthenticatedWebhooks bool   `yaml:"allow_unauthenticated_webhooks" toml:"allow_unauthenticated_webhooks"`
+	DiscordAppURL                string `yaml:"discord_app_url" toml:"discord_app_url"`
+	// AdminToken authorises the HTTP admin actions, which are disabled without one
+	AdminToken     string `yaml:"admin_token" toml:"admin_token"`
+	SyncCommands   bool   `yaml:"sync_commands" toml:"sync_commands"`
+	RemoveCommands bool   `yaml:"remove_commands" toml:"remove_commands"`
+	// DataDir is where settings and links are kept between restarts
+	DataDir string `yaml:"data_dir" toml:"data_dir"`
+	// DrainDelay is how long the bot reports not ready before it stops taking requests
+	DrainDelay Duration `yaml:"drain_delay" toml:"drain_delay"`
+	// ShutdownTimeout is how long the HTTP server and delivery queue get to drain
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// LogLevel is the least severe level logged: debug, info, warn or error
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+	// LogFormat is text for people or json for log collectors
+	LogFormat string `yaml:"log_format" toml:"log_format"`
+	// RedactPII keeps consumer names and review text out of the logs
+	RedactPII bool `yaml:"redact_pii" toml:"redact_pii"`
+}
+
+// Duration is a time.Duration that reads from files as a string like "15s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() Config {
+	return Config{
+		ListenAddr:      ":8080",
+		PublicURL:       "http://localhost:8080",
+		Environment:     "staging",
+		DiscordAppURL:   "https://discord.com/app",
+		SyncCommands:    true,
+		DataDir:         "data",
+		DrainDelay:      Duration{5 * time.Second},
+		ShutdownTimeout: Duration{15 * time.Second},
+		LogLevel:        "info",
+		LogFormat:       "text",
+	}
+}
+
+// Profile is the set of Trustpilot hosts that make up one environment.
+type Profile struct {
+	AuthURL string
+	APIURL  string
+	// SiteURL is the public site reviews are linked to
+	SiteURL string
+	// WebhookOrigin is the host the links in webhook payloads point at
+	WebhookOrigin string
+}
+
+// Profiles are the environments that can be picked with the environment setting.
+var Profiles = map[string]Profile{
+	"staging": {
+		AuthURL:       "https://authenticate.tp-staging.com",
+		APIURL:        "https://api.tp-staging.com",
+		SiteURL:       "https://www.tp-staging.com",
+		WebhookOrigin: "https://api.tp-staging.com",
+	},
+	"production": {
+		AuthURL:       "https://authenticate.trustpilot.com",
+		APIURL:        "https://api.trustpilot.com",
+		SiteURL:       "https://www.trustpilot.com",
+		WebhookOrigin: "https://api.trustpilot.com",
+	},
+}
+
+// applyProfile fills in every host that wasn't set explicitly from the
+// selected environment's profile.
+func (c *Config) applyProfile() {
+	profile, ok := Profiles[c.Environment]
+	if !ok {
+		return
+	}
+	for _, host := range []struct {
+		value   *string
+		profile string
+	}{
+		{&c.AuthURL, profile.AuthURL},
+		{&c.APIURL, profile.APIURL},
+		{&c.SiteURL, profile.SiteURL},
+		{&c.WebhookOrigin, profile.WebhookOrigin},
+	} {
+		if *host.value == "" {
+			*host.value = host.profile
+		}
+	}
+}
+
+// RedirectURL is where Trustpilot sends users back to after logging in.
+func (c *Config) RedirectURL() string {
+	return strings.TrimSuffix(c.PublicURL, "/") + "/auth"
+}
+
+// setting ties a Config field to its flag, environment variable and file key.
+type setting struct {
+	name  string
+	env   string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, value string) error
+	// isBool settings can be passed as a bare flag, like -rmcmd
+	isBool bool
+	// secret settings are redacted when printed
+	secret bool
+	// required settings must be non-empty after loading
+	required bool
+}
+
+func stringSetting(name string, env string, usage string, field func(c *Config) *string) setting {
+	return setting{
+		name:  name,
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func boolSetting(name string, env string, usage string, field func(c *Config) *bool) setting {
+	return setting{
+		name:   name,
+		env:    env,
+		usage:  usage,
+		isBool: true,
+		get:    func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, value string) error {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s must be true or false, got %q", name, value)
+			}
+			*field(c) = parsed
+			return nil
+		},
+	}
+}
+
+func durationSetting(name string, env string, usage string, field func(c *Config) *Duration) setting {
+	return setting{
+		name:  name,
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return field(c).String() },
+		set: func(c *Config, value string) error {
+			if err := field(c).UnmarshalText([]byte(value)); err != nil {
+				return fmt.Errorf("%s must be a duration like 15s, got %q", name, value)
+			}
+			return nil
+		},
+	}
+}
+
+func required(s setting) setting {
+	s.required = true
+	return s
+}
+
+func secret(s setting) setting {
+	s.secret = true
+	return s
+}
+
+var settings = []setting{
+	required(secret(stringSetting("discord_token", "DISCORD_TOKEN", "Bot access token", func(c *Config) *string { return &c.DiscordToken }))),
+	stringSetting("guild_id", "GUILD_ID", "Test guild ID. If not passed - bot registers commands globally", func(c *Config) *string { return &c.GuildID }),
+	required(stringSetting("client_id", "CLIENT_ID", "Trustpilot API client ID used by /login", func(c *Config) *string { return &c.ClientID })),
+	required(stringSetting("listen_addr", "LISTEN_ADDR", "Address the HTTP server listens on", func(c *Config) *string { return &c.ListenAddr })),
+	required(stringSetting("public_url", "PUBLIC_URL", "URL the HTTP server is reachable on from a browser", func(c *Config) *string { return &c.PublicURL })),
+	required(stringSetting("environment", "TRUSTPILOT_ENVIRONMENT", "Trustpilot environment profile, staging or production", func(c *Config) *string { return &c.Environment })),
+	required(stringSetting("auth_url", "TRUSTPILOT_AUTH_URL", "Trustpilot authentication host, overrides the environment's", func(c *Config) *string { return &c.AuthURL })),
+	required(stringSetting("api_url", "TRUSTPILOT_API_URL", "Trustpilot API host, overrides the environment's", func(c *Config) *string { return &c.APIURL })),
+	required(stringSetting("site_url", "TRUSTPILOT_SITE_URL", "Trustpilot public site host, overrides the environment's", func(c *Config) *string { return &c.SiteURL })),
+	required(stringSetting("webhook_origin", "TRUSTPILOT_WEBHOOK_ORIGIN", "Host the links in Trustpilot webhooks point at, overrides the environment's", func(c *Config) *string { return &c.WebhookOrigin })),
+	required(stringSetting("discord_app_url", "DISCORD_APP_URL", "Where users are sent after logging in", func(c *Config) *string { return &c.DiscordAppURL })),
+	secret(stringSetting("webhook_secret", "TRUSTPILOT_WEBHOOK_SECRET", "Password in the webhook URL registered with Trustpilot", func(c *Config) *string { return &c.WebhookSecret })),
+	boolSetting("allow_unauthenticated_webhooks", "ALLOW_UNAUTHENTICATED_WEBHOOKS", "Accept webhooks without a webhook_secret, for local testing only", func(c *Config) *bool { return &c.AllowUnauthenticatedWebhooks }),
+	secret(stringSetting("admin_token", "ADMIN_TOKEN", "Bearer token for the HTTP admin actions, disabled if empty", func(c *Config) *string { return &c.AdminToken })),
+	boolSetting("sync_commands", "SYNC_COMMANDS", "Bring the registered commands up to date on startup", func(c *Config) *bool { return &c.SyncCommands }),
+	boolSetting("remove_commands", "REMOVE_COMMANDS", "Remove all commands after shutdowning or not", func(c *Config) *bool { return &c.RemoveCommands }),
+	required(stringSetting("data_dir", "DATA_DIR", "Directory settings and links are kept in", func(c *Config) *string { return &c.DataDir })),
+	durationSetting("drain_delay", "DRAIN_DELAY", "How long to report not ready before shutting down", func(c *Config) *Duration { return &c.DrainDelay }),
+	durationSetting("shutdown_timeout", "SHUTDOWN_TIMEOUT", "How long to wait for requests and queued messages on shutdown", func(c *Config) *Duration { return &c.ShutdownTimeout }),
+	stringSetting("log_level", "LOG_LEVEL", "Least severe level logged: debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+	stringSetting("log_format", "LOG_FORMAT", "Log format, text or json", func(c *Config) *string { return &c.LogFormat }),
+	boolSetting("redact_pii", "REDACT_PII", "Keep consumer names and review text out of the logs", func(c *Config) *bool { return &c.RedactPII }),
+}
+
+// flagNames maps settings to their command line flag where it differs from
+// the file key, keeping the flags the bot has always accepted.
+var flagNames = map[string]string{
+	"discord_token":   "token",
+	"guild_id":        "guild",
+	"remove_commands": "rmcmd",
+}
+
+func flagName(s setting) string {
+	if name, ok := flagNames[s.name]; ok {
+		return name
+	}
+	return strings.ReplaceAll(s.name, "_", "-")
+}
+
+// flagValue records the raw value of a flag so it can be applied after the
+// file and environment, in the same way as every other source.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string     { return f.value }
+func (f *flagValue) Set(v string) error { f.value = v; return nil }
+func (f *flagValue) IsBoolFlag() bool   { return f.isBool }
+
+// Load resolves the configuration from the file named by -config or
+// CONFIG_FILE, the environment and the flags in args. Every flag is
+// registered on flags, so callers can add their own before calling Load.
+// Only problems reading the sources are returned; call Validate to check
+// that the result is usable.
+func Load(flags *flag.FlagSet, args []string) (*Config, error) {
+	configFile := flags.String("config", "", "Path to a YAML or TOML config file")
+	flagValues := map[string]*flagValue{}
+	for _, s := range settings {
+		flagValues[flagName(s)] = &flagValue{isBool: s.isBool}
+		flags.Var(flagValues[flagName(s)], flagName(s), fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// .env is a convenience for local development, so it's fine if it's missing
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	cfg := Default()
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []error
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(&cfg, value); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if flagName(s) == f.Name {
+				if err := s.set(&cfg, flagValues[f.Name].value); err != nil {
+					problems = append(problems, fmt.Errorf("-%s: %w", f.Name, err))
+				}
+			}
+		}
+	})
+	cfg.applyProfile()
+
+	return &cfg, errors.Join(problems...)
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every setting that is missing or malformed, naming
+// where it can be set.
+func (c *Config) Validate() error {
+	var problems []error
+	if _, ok := Profiles[c.Environment]; !ok && c.Environment != "" {
+		problems = append(problems, fmt.Errorf("environment must be one of staging or production, got %q", c.Environment))
+	}
+	for _, s := range settings {
+		if s.required && s.get(c) == "" {
+			problems = append(problems, fmt.Errorf("%s is required: set %s, -%s or %s in the config file", s.name, s.env, flagName(s), s.name))
+		}
+	}
+
+	if c.WebhookSecret == "" && !c.AllowUnauthenticatedWebhooks {
+		problems = append(problems, fmt.Errorf("webhook_secret is required: set TRUSTPILOT_WEBHOOK_SECRET, -webhook-secret or webhook_secret in the config file, or allow_unauthenticated_webhooks to accept anyone's webhooks"))
+	}
+
+	for _, u := range []struct {
+		name  string
+		value string
+	}{
+		{"public_url", c.PublicURL},
+		{"auth_url", c.AuthURL},
+		{"api_url", c.APIURL},
+		{"site_url", c.SiteURL},
+		{"webhook_origin", c.WebhookOrigin},
+		{"discord_app_url", c.DiscordAppURL},
+	} {
+		if u.value == "" {
+			continue
+		}
+		parsed, err := url.Parse(u.value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Errorf("%s must be an absolute URL, got %q", u.name, u.value))
+		}
+	}
+
+	if c.DrainDelay.Duration < 0 {
+		problems = append(problems, fmt.Errorf("drain_delay can't be negative, got %s", c.DrainDelay))
+	}
+	if c.ShutdownTimeout.Duration <= 0 {
+		problems = append(problems, fmt.Errorf("shutdown_timeout must be positive, got %s", c.ShutdownTimeout))
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error", "":
+	default:
+		problems = append(problems, fmt.Errorf("log_level must be one of debug, info, warn or error, got %q", c.LogLevel))
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json", "":
+	default:
+		problems = append(problems, fmt.Errorf("log_format must be text or json, got %q", c.LogFormat))
+	}
+
+	return errors.Join(problems...)
+}
+
+// String lists every setting and its value, with secrets redacted.
+func (c *Config) String() string {
+	result := ""
+	for _, s := range settings {
+		value := s.get(c)
+		if s.secret && value != "" {
+			value = "[redacted]"
+		}
+		result += fmt.Sprintf("%s = %q\n", s.name, value)
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/liukaku/discord-tp/cmd/config"
+)
+
+// loadConfig resolves and validates the configuration, exiting with every
+// problem found rather than starting half configured.
+func loadConfig(flags *flag.FlagSet, args []string) *config.Config {
+	cfg, err := config.Load(flags, args)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Printf("Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// configCommand implements the config subcommand. "config check" prints the
+// resolved configuration and reports anything missing or malformed.
+func configCommand(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Println("Usage: config check [flags]")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+	cfg, err := config.Load(flags, args[1:])
+	if err != nil {
+		fmt.Printf("Error loading configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(cfg)
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("\nProblems:\n%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("\nConfiguration OK")
+}
@@ -0,0 +1,164 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	ErrQueueFull   = errors.New("delivery queue is full")
+	ErrQueueClosed = errors.New("delivery queue is closed")
+)
+
+// Message is a Discord message waiting to be sent to a channel, or an
+// edit waiting to be made to a thread.
+type Message struct {
+	ChannelID string
+	Send      *discordgo.MessageSend
+	// ThreadEdit, if set, edits the thread ChannelID instead of sending
+	// anything, and Sent is called with the thread once it is edited
+	ThreadEdit *ThreadEdit
+	// Thread, if set, is started on the message once it is sent
+	Thread *discordgo.ThreadStart
+	// ForumPost, if set, posts the message as a new post in the forum
+	// ChannelID instead, and Thread is ignored
+	ForumPost *ForumPost
+	// Sent, if set, is called with the sent message and its thread, which
+	// is nil when none was started
+	Sent func(message *discordgo.Message, thread *discordgo.Channel)
+}
+
+// ForumPost is the post a message starts in a forum channel.
+type ForumPost struct {
+	Name string
+	// AutoArchiveDuration is the minutes without messages before Discord
+	// archives the post
+	AutoArchiveDuration int
+	// TagNames are the tags to apply, most important first, of which those
+	// the forum has are used
+	TagNames []string
+}
+
+// ThreadEdit is a change to a review's thread or forum post.
+type ThreadEdit struct {
+	// Name, if set, renames the thread
+	Name string
+	// Status, if set, changes a forum post's status tag
+	Status  string
+	Archive bool
+}
+
+// Queue sends messages to Discord in the background, so webhook requests
+// don't wait on Discord and nothing accepted is lost on shutdown.
+type Queue struct {
+	mu       sync.RWMutex
+	messages chan Message
+	closed   bool
+	send     func(m Message) error
+	done     chan struct{}
+	// lastActive is the unix nano time the worker last finished a message or started
+	lastActive atomic.Int64
+}
+
+// NewQueue returns a queue holding up to size messages that are delivered with send.
+func NewQueue(size int, send func(m Message) error) *Queue {
+	return &Queue{
+		messages: make(chan Message, size),
+		send:     send,
+		done:     make(chan struct{}),
+	}
+}
+
+// Enqueue adds m to the queue without blocking.
+func (q *Queue) Enqueue(m Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.messages <- m:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// EnqueueAll adds every one of messages to the queue without blocking, or
+// none of them if they don't all fit.
+func (q *Queue) EnqueueAll(messages []Message) error {
+	// Holding the write lock keeps Enqueue from taking the room we check for
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if cap(q.messages)-len(q.messages) < len(messages) {
+		return ErrQueueFull
+	}
+
+	for _, m := range messages {
+		q.messages <- m
+	}
+	return nil
+}
+
+// Len returns the number of messages waiting to be sent.
+func (q *Queue) Len() int {
+	return len(q.messages)
+}
+
+// Start starts delivering messages in the background.
+func (q *Queue) Start(ctx context.Context) error {
+	q.lastActive.Store(time.Now().UnixNano())
+	go func() {
+		defer close(q.done)
+		for m := range q.messages {
+			if err := q.send(m); err != nil {
+				slog.Error("cannot deliver message", "channel_id", m.ChannelID, "error", err)
+			}
+			q.lastActive.Store(time.Now().UnixNano())
+		}
+	}()
+	return nil
+}
+
+// Check reports the queue as wedged when messages are waiting but none has
+// gone out for stallAfter.
+func (q *Queue) Check(stallAfter time.Duration) error {
+	waiting := q.Len()
+	if waiting == 0 {
+		return nil
+	}
+	idle := time.Since(time.Unix(0, q.lastActive.Load()))
+	if idle > stallAfter {
+		return fmt.Errorf("%d messages waiting and nothing sent for %s", waiting, idle.Round(time.Second))
+	}
+	return nil
+}
+
+// Drain stops accepting messages and waits for the ones already queued to
+// be sent, giving up when ctx is done.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d messages left undelivered: %w", q.Len(), ctx.Err())
+	}
+}
@@ -0,0 +1,102 @@
+package delivery
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/forum"
+)
+
+// ThreadEditor is the part of the Discord API threads are edited with.
+type ThreadEditor interface {
+	Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelEditComplex(channelID string, data *discordgo.ChannelEdit, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+}
+
+// Discord is the part of the Discord API messages are delivered with.
+type Discord interface {
+	ThreadEditor
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	MessageThreadStartComplex(channelID string, messageID string, data *discordgo.ThreadStart, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ForumThreadStartComplex(channelID string, threadData *discordgo.ThreadStart, messageData *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+}
+
+var _ Discord = (*discordgo.Session)(nil)
+
+// Deliver sends m with discord and starts its thread, if it has one.
+func Deliver(discord Discord, m Message) error {
+	if m.ThreadEdit != nil {
+		return EditThread(discord, m)
+	}
+	if m.ForumPost != nil {
+		return deliverForumPost(discord, m)
+	}
+
+	message, err := discord.ChannelMessageSendComplex(m.ChannelID, m.Send)
+	if err != nil {
+		return err
+	}
+
+	var thread *discordgo.Channel
+	if m.Thread != nil {
+		// The message is out either way, so Sent still hears about it
+		thread, err = discord.MessageThreadStartComplex(m.ChannelID, message.ID, m.Thread)
+		if err != nil {
+			err = fmt.Errorf("cannot start thread: %w", err)
+		}
+	}
+	if m.Sent != nil {
+		m.Sent(message, thread)
+	}
+	return err
+}
+
+func deliverForumPost(discord Discord, m Message) error {
+	channel, err := discord.Channel(m.ChannelID)
+	if err != nil {
+		return fmt.Errorf("cannot look up forum tags: %w", err)
+	}
+
+	thread, err := discord.ForumThreadStartComplex(m.ChannelID, &discordgo.ThreadStart{
+		Name:                m.ForumPost.Name,
+		AutoArchiveDuration: m.ForumPost.AutoArchiveDuration,
+		AppliedTags:         forum.TagIDs(channel.AvailableTags, m.ForumPost.TagNames),
+	}, m.Send)
+	if err != nil {
+		return err
+	}
+	if m.Sent != nil {
+		// A post's first message shares its ID
+		m.Sent(&discordgo.Message{ID: thread.ID, ChannelID: thread.ID}, thread)
+	}
+	return nil
+}
+
+// EditThread makes m's ThreadEdit to the thread m.ChannelID.
+func EditThread(discord ThreadEditor, m Message) error {
+	edit := &discordgo.ChannelEdit{Name: m.ThreadEdit.Name}
+	if m.ThreadEdit.Archive {
+		edit.Archived = &m.ThreadEdit.Archive
+	}
+	if m.ThreadEdit.Status != "" {
+		thread, err := discord.Channel(m.ChannelID)
+		if err != nil {
+			return fmt.Errorf("cannot look up forum post: %w", err)
+		}
+		parent, err := discord.Channel(thread.ParentID)
+		if err != nil {
+			return fmt.Errorf("cannot look up forum tags: %w", err)
+		}
+		tags := forum.WithStatus(parent.AvailableTags, thread.AppliedTags, m.ThreadEdit.Status)
+		edit.AppliedTags = &tags
+	}
+
+	thread, err := discord.ChannelEditComplex(m.ChannelID, edit)
+	if err != nil {
+		return err
+	}
+	if m.Sent != nil {
+		m.Sent(nil, thread)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package delivery
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/forum"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+// ThreadState is where the threads reviews are discussed in are tracked.
+type ThreadState interface {
+	GetReviewThreads(reviewID string) []types.ReviewThread
+	RemoveReviewThread(reviewID string, threadID string)
+}
+
+// ResolveThreads returns the edits resolving the threads reviewID is
+// discussed in, now it has been replied to. Threads are renamed as resolved
+// and forum posts tagged as replied, then both are archived and forgotten.
+func ResolveThreads(state ThreadState, reviewID string) []Message {
+	var edits []Message
+	for _, thread := range state.GetReviewThreads(reviewID) {
+		edit := &ThreadEdit{Archive: true}
+		if thread.Forum {
+			edit.Status = forum.StatusReplied
+		} else {
+			edit.Name = render.ResolvedThreadName(thread.Name)
+		}
+		threadID := thread.ThreadID
+		edits = append(edits, Message{
+			ChannelID:  threadID,
+			ThreadEdit: edit,
+			Sent: func(*discordgo.Message, *discordgo.Channel) {
+				state.RemoveReviewThread(reviewID, threadID)
+			},
+		})
+	}
+	return edits
+}
+
+// EscalateThreads returns the edits tagging those of threads that are forum
+// posts in channelID as escalated.
+func EscalateThreads(threads []types.ReviewThread, channelID string) []Message {
+	var edits []Message
+	for _, thread := range threads {
+		if thread.Forum && thread.ChannelID == channelID {
+			edits = append(edits, Message{ChannelID: thread.ThreadID, ThreadEdit: &ThreadEdit{Status: forum.StatusEscalated}})
+		}
+	}
+	return edits
+}
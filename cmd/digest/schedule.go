@@ -0,0 +1,147 @@
+// Package digest summarises the reviews a route received over a period and
+// posts the summaries on a schedule.
+package digest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is when digests go out: a cron expression of minute, hour, day
+// of month, month and day of week, like "0 9 * * 1" for Mondays at 9:00.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day field; when both day fields are
+	// restricted, either may match, as in cron
+	domAny, dowAny bool
+}
+
+// shortcuts are the named schedules ParseSchedule accepts.
+var shortcuts = map[string]string{
+	"@hourly": "0 * * * *",
+	"@daily":  "0 9 * * *",
+	"daily":   "0 9 * * *",
+	"@weekly": "0 9 * * 1",
+	"weekly":  "0 9 * * 1",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseSchedule parses a cron expression, or one of daily and weekly,
+// which are 9:00 every day and Mondays.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if shortcut, ok := shortcuts[spec]; ok {
+		spec = shortcut
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("%q needs 5 fields: minute hour day-of-month month day-of-week", spec)
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return Schedule{}, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return Schedule{}, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return Schedule{}, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return Schedule{}, fmt.Errorf("month: %w", err)
+	}
+	// 7 is Sunday as well as 0
+	if s.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return Schedule{}, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+// parseField parses a comma separated list of *, values, ranges and steps
+// like */15 or 1-5/2 into a bit per allowed value.
+func parseField(field string, low int, high int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q", stepPart)
+			}
+		}
+
+		from, to := low, high
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = parseValue(first, low, high, names); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = parseValue(last, low, high, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = high
+			}
+			if from > to {
+				return 0, fmt.Errorf("range %q runs backwards", rangePart)
+			}
+		}
+		for value := from; value <= to; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, low int, high int, names map[string]int) (int, error) {
+	if value, ok := names[s]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil || value < low || value > high {
+		return 0, fmt.Errorf("%q isn't between %d and %d", s, low, high)
+	}
+	return value, nil
+}
+
+// Matches reports whether t falls in a minute the schedule runs at.
+func (s Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Next returns the first minute after t the schedule runs at, in t's
+// location, or the zero time if it doesn't run within a year.
+func (s Schedule) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(1, 0, 1); next.Before(end); next = next.Add(time.Minute) {
+		if s.Matches(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
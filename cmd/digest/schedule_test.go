@@ -0,0 +1,68 @@
+package digest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"daily", "@weekly", "*/15 9-17 * * mon-fri", "0 9 1,15 * *", "30 8 * jan-mar sun", "0 9 * * 7"} {
+		if _, err := ParseSchedule(spec); err != nil {
+			t.Errorf("%q: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "0 9 * *", "60 9 * * *", "0 24 * * *", "0 9 0 * *", "0 9 * 13 *", "0 9 * * 8", "0 9-5 * * *", "*/0 9 * * *", "0 9 * * funday"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q parsed", spec)
+		}
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	// 3 June 2024 is a Monday
+	monday := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"daily", monday, true},
+		{"daily", monday.Add(time.Minute), false},
+		{"weekly", monday, true},
+		{"weekly", monday.AddDate(0, 0, 1), false},
+		{"0 9 * * 7", monday.AddDate(0, 0, 6), true},
+		{"*/15 9-17 * * mon-fri", monday.Add(8*time.Hour + 45*time.Minute), true},
+		{"*/15 9-17 * * mon-fri", monday.Add(10 * time.Minute), false},
+		// Either day field matches when both are restricted
+		{"0 9 15 * mon", monday, true},
+		{"0 9 15 * mon", monday.AddDate(0, 0, 12), true},
+		{"0 9 15 * mon", monday.AddDate(0, 0, 1), false},
+		{"0 9 3 jul *", monday, false},
+	} {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		if got := schedule.Matches(test.t); got != test.want {
+			t.Errorf("%q at %s: got %t", test.spec, test.t.Format(time.RFC1123), got)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	schedule, _ := ParseSchedule("weekly")
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Wednesday
+	now := time.Date(2024, 6, 5, 14, 30, 0, 0, london)
+	if got, want := schedule.Next(now), time.Date(2024, 6, 10, 9, 0, 0, 0, london); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	never, _ := ParseSchedule("0 9 31 feb *")
+	if got := never.Next(now); !got.IsZero() {
+		t.Errorf("got %s for a schedule that never runs", got)
+	}
+}
@@ -0,0 +1,133 @@
+package digest
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
+
+// State is where the scheduler finds routes and their waiting reviews. A
+// period's Since is when the route last had a digest, which is kept between
+// restarts so digests missed while the bot was down are caught up on.
+type State interface {
+	GetRoutes() []routing.Route
+	GetDigestPeriod(channelID string) Period
+	// CompleteDigest starts a new period at now once a digest of the first
+	// posted reviews has gone out, remembering summary for the next
+	CompleteDigest(channelID string, now time.Time, posted int, summary Summary)
+}
+
+// Queue is where digests are sent from.
+type Queue interface {
+	Enqueue(m delivery.Message) error
+}
+
+// Scheduler posts each route's digest when its schedule says.
+type Scheduler struct {
+	state State
+	queue Queue
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewScheduler returns a scheduler that sends digests through queue.
+func NewScheduler(state State, queue Queue) *Scheduler {
+	return &Scheduler{
+		state: state,
+		queue: queue,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start checks for due digests at the start of every minute in the background.
+func (s *Scheduler) Start(ctx context.Context) error {
+	go func() {
+		defer close(s.done)
+		for {
+			// A timer to each minute rather than a ticker, which drifts
+			now := time.Now()
+			timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case now := <-timer.C:
+				s.RunDue(now)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops checking for digests, waiting for one being sent to finish.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunDue sends the digests of the routes scheduled since their last digest
+// and up to now. However many runs a route missed, it gets one digest.
+func (s *Scheduler) RunDue(now time.Time) {
+	for _, route := range s.state.GetRoutes() {
+		if route.Digest.IsZero() {
+			continue
+		}
+		schedule, err := ParseSchedule(route.Digest.Schedule)
+		if err != nil {
+			slog.Warn("skipping digest with a bad schedule", "channel_id", route.ChannelID, "schedule", route.Digest.Schedule, "error", err)
+			continue
+		}
+		location, err := time.LoadLocation(route.Digest.Timezone)
+		if err != nil {
+			location = time.UTC
+		}
+		period := s.state.GetDigestPeriod(route.ChannelID)
+		lastRun := period.Since
+		if lastRun.IsZero() {
+			// Nothing to catch up on, so only this minute counts
+			lastRun = now.Truncate(time.Minute).Add(-time.Nanosecond)
+		}
+		next := schedule.Next(lastRun.In(location))
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		if now.Sub(next) >= time.Minute {
+			slog.Info("catching up on missed digest", "channel_id", route.ChannelID, "due", next)
+		}
+		s.send(route, period, now)
+	}
+}
+
+func (s *Scheduler) send(route routing.Route, period Period, now time.Time) {
+	summary := Summarize(period.Reviews)
+	message := delivery.Message{
+		ChannelID: route.ChannelID,
+		Send: &discordgo.MessageSend{
+			Embeds:          []*discordgo.MessageEmbed{Embed(summary, period.Previous, period.Since, now)},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	}
+	if route.Forum {
+		message.ForumPost = &delivery.ForumPost{Name: "Review digest · " + now.Format("2 Jan 2006")}
+	}
+
+	if err := s.queue.Enqueue(message); err != nil {
+		// The reviews stay waiting and go in the next digest
+		slog.Error("cannot queue digest", "channel_id", route.ChannelID, "error", err)
+		return
+	}
+	// Only the counts are needed to compare against
+	summary.Best, summary.Worst = nil, nil
+	s.state.CompleteDigest(route.ChannelID, now, len(period.Reviews), summary)
+	slog.Info("queued digest", "guild_id", route.GuildID, "channel_id", route.ChannelID, "reviews", len(period.Reviews))
+}
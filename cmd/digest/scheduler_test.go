@@ -0,0 +1,113 @@
+package digest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
+
+type fakeState struct {
+	sync.Mutex
+	routes  []routing.Route
+	periods map[string]Period
+}
+
+func (f *fakeState) GetRoutes() []routing.Route { return f.routes }
+
+func (f *fakeState) GetDigestPeriod(channelID string) Period {
+	f.Lock()
+	defer f.Unlock()
+	return f.periods[channelID]
+}
+
+func (f *fakeState) CompleteDigest(channelID string, now time.Time, posted int, summary Summary) {
+	f.Lock()
+	defer f.Unlock()
+	f.periods[channelID] = Period{Since: now, Reviews: f.periods[channelID].Reviews[posted:], Previous: summary}
+}
+
+type fakeQueue struct {
+	messages []delivery.Message
+}
+
+func (q *fakeQueue) Enqueue(m delivery.Message) error {
+	q.messages = append(q.messages, m)
+	return nil
+}
+
+func TestRunDue(t *testing.T) {
+	state := &fakeState{
+		routes: []routing.Route{
+			{ChannelID: "daily", Digest: routing.Digest{Schedule: "daily"}},
+			{ChannelID: "new-york", Digest: routing.Digest{Schedule: "daily", Timezone: "America/New_York"}},
+			{ChannelID: "forum", Forum: true, Digest: routing.Digest{Schedule: "0 9 * * *"}},
+			{ChannelID: "none"},
+		},
+		periods: map[string]Period{
+			"daily": {Reviews: []render.Review{{Stars: 5}, {Stars: 3}}},
+		},
+	}
+	queue := &fakeQueue{}
+	scheduler := NewScheduler(state, queue)
+
+	now := time.Date(2024, 6, 3, 9, 0, 30, 0, time.UTC)
+	scheduler.RunDue(now)
+	// The same minute again sends nothing more
+	scheduler.RunDue(now.Add(20 * time.Second))
+
+	if len(queue.messages) != 2 {
+		t.Fatalf("queued %d digests, want 2", len(queue.messages))
+	}
+	if queue.messages[0].ChannelID != "daily" || queue.messages[1].ChannelID != "forum" {
+		t.Errorf("queued to %s and %s", queue.messages[0].ChannelID, queue.messages[1].ChannelID)
+	}
+	if post := queue.messages[1].ForumPost; post == nil || post.Name != "Review digest · 3 Jun 2024" {
+		t.Errorf("got forum post %+v", post)
+	}
+
+	period := state.periods["daily"]
+	if len(period.Reviews) != 0 || !period.Since.Equal(now) || period.Previous.Count != 2 || period.Previous.Best != nil {
+		t.Errorf("got next period %+v", period)
+	}
+
+	// 9:00 in New York
+	scheduler.RunDue(now.Add(4 * time.Hour))
+	if len(queue.messages) != 3 || queue.messages[2].ChannelID != "new-york" {
+		t.Errorf("got %d digests, want the New York one too", len(queue.messages))
+	}
+}
+
+func TestRunDueCatchesUpMissedDigests(t *testing.T) {
+	lastDigest := time.Date(2024, 6, 1, 9, 0, 5, 0, time.UTC)
+	state := &fakeState{
+		routes: []routing.Route{{ChannelID: "daily", Digest: routing.Digest{Schedule: "daily"}}},
+		periods: map[string]Period{
+			"daily": {Since: lastDigest, Reviews: []render.Review{{Stars: 4}}},
+		},
+	}
+	queue := &fakeQueue{}
+	scheduler := NewScheduler(state, queue)
+
+	// Down since before the 9:00 runs on the 2nd and 3rd
+	now := time.Date(2024, 6, 3, 11, 15, 0, 0, time.UTC)
+	scheduler.RunDue(now)
+	scheduler.RunDue(now.Add(time.Minute))
+
+	if len(queue.messages) != 1 {
+		t.Fatalf("queued %d digests, want one catching up", len(queue.messages))
+	}
+	if period := state.periods["daily"]; !period.Since.Equal(now) || period.Previous.Count != 1 {
+		t.Errorf("got next period %+v", period)
+	}
+
+	// Not due again until 9:00 tomorrow
+	scheduler.RunDue(time.Date(2024, 6, 4, 8, 59, 0, 0, time.UTC))
+	scheduler.RunDue(time.Date(2024, 6, 4, 9, 0, 0, 0, time.UTC))
+	if len(queue.messages) != 2 {
+		t.Errorf("queued %d digests, want the next day's too", len(queue.messages))
+	}
+}
@@ -0,0 +1,122 @@
+package digest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// Period is a route's reviews waiting for its next digest.
+type Period struct {
+	// Since is when the period started, the last digest or when digests
+	// were turned on
+	Since   time.Time
+	Reviews []render.Review `json:",omitempty"`
+	// Previous summarises the period before, for showing the change
+	Previous Summary
+}
+
+// Summary is what a digest reports about a period's reviews.
+type Summary struct {
+	Count   int
+	Average float64
+	// Stars counts the reviews with each rating, Stars[0] being 1★
+	Stars [5]int
+	// Best and Worst are the highest and lowest rated reviews, the most
+	// recent when there is a tie
+	Best  *render.Review `json:",omitempty"`
+	Worst *render.Review `json:",omitempty"`
+}
+
+// clampStars brings a rating Trustpilot shouldn't send into 1 to 5.
+func clampStars(stars int) int {
+	return min(max(stars, 1), 5)
+}
+
+// Summarize counts and averages reviews and picks out the best and worst.
+func Summarize(reviews []render.Review) Summary {
+	var s Summary
+	total := 0
+	for n := range reviews {
+		review := &reviews[n]
+		stars := clampStars(review.Stars)
+		s.Count++
+		s.Stars[stars-1]++
+		total += stars
+		if s.Best == nil || stars > clampStars(s.Best.Stars) || (stars == clampStars(s.Best.Stars) && review.CreatedAt.After(s.Best.CreatedAt)) {
+			s.Best = review
+		}
+		if s.Worst == nil || stars < clampStars(s.Worst.Stars) || (stars == clampStars(s.Worst.Stars) && review.CreatedAt.After(s.Worst.CreatedAt)) {
+			s.Worst = review
+		}
+	}
+	if s.Count > 0 {
+		s.Average = float64(total) / float64(s.Count)
+	}
+	return s
+}
+
+// Embed shows s, for the period from since to now, against previous.
+func Embed(s Summary, previous Summary, since time.Time, now time.Time) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:     "Review digest",
+		Color:     render.Review{Stars: int(s.Average + 0.5)}.Colour(),
+		Timestamp: now.Format(time.RFC3339),
+		Footer:    &discordgo.MessageEmbedFooter{Text: "Trustpilot"},
+	}
+	period := fmt.Sprintf("since <t:%d:f>", since.Unix())
+	if since.IsZero() {
+		period = "so far"
+	}
+	if s.Count == 0 {
+		embed.Description = fmt.Sprintf("No new reviews %s.", period)
+		return embed
+	}
+
+	embed.Description = fmt.Sprintf("**%d** %s %s, averaging **%.1f★**.", s.Count, render.Plural(s.Count, "review", "reviews"), period, s.Average)
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Ratings", Value: render.Distribution(s.Stars)})
+	if previous.Count > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Change on the previous period",
+			Value: fmt.Sprintf("Reviews: %d (%s)\nAverage: %.1f★ (%s)",
+				s.Count, signed(float64(s.Count-previous.Count), "%+.0f"),
+				s.Average, signed(s.Average-previous.Average, "%+.1f")),
+		})
+	}
+	if s.Best != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Best", Value: highlight(*s.Best)})
+	}
+	if s.Worst != nil && s.Worst != s.Best && clampStars(s.Worst.Stars) < clampStars(s.Best.Stars) {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Worst", Value: highlight(*s.Worst)})
+	}
+	return embed
+}
+
+// highlight is a review's line in a digest, linked where it has a link.
+func highlight(r render.Review) string {
+	title := r.Title
+	if title == "" {
+		title = r.Text
+	}
+	title = render.Escape(render.Truncate(title, 100))
+	if r.URL != "" {
+		title = "[" + title + "](" + r.URL + ")"
+	}
+	line := r.StarBar() + " " + title
+	if r.ConsumerName != "" {
+		line += " by " + render.NeutraliseMentions(r.ConsumerName)
+	}
+	return render.Truncate(line, render.MaxFieldValue)
+}
+
+// signed formats a change, showing no change as "±0".
+func signed(change float64, format string) string {
+	formatted := fmt.Sprintf(format, change)
+	if strings.Trim(formatted, "+-0.") == "" {
+		return "±0"
+	}
+	return formatted
+}
@@ -0,0 +1,73 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	reviews := []render.Review{
+		{ID: "a", Stars: 5, CreatedAt: day},
+		{ID: "b", Stars: 1, CreatedAt: day},
+		{ID: "c", Stars: 5, CreatedAt: day.Add(time.Hour)},
+		{ID: "d", Stars: 3, CreatedAt: day},
+	}
+	s := Summarize(reviews)
+	if s.Count != 4 || s.Average != 3.5 || s.Stars != [5]int{1, 0, 1, 0, 2} {
+		t.Errorf("got %+v", s)
+	}
+	if s.Best.ID != "c" || s.Worst.ID != "b" {
+		t.Errorf("got best %s and worst %s", s.Best.ID, s.Worst.ID)
+	}
+
+	// Ratings out of range count as the nearest, newest first among equals
+	s = Summarize([]render.Review{
+		{ID: "high", Stars: 9, CreatedAt: day},
+		{ID: "low", Stars: 0, CreatedAt: day},
+		{ID: "five", Stars: 5, CreatedAt: day.Add(time.Hour)},
+		{ID: "one", Stars: 1, CreatedAt: day.Add(time.Hour)},
+	})
+	if s.Best.ID != "five" || s.Worst.ID != "one" {
+		t.Errorf("got best %s and worst %s out of range", s.Best.ID, s.Worst.ID)
+	}
+
+	if empty := Summarize(nil); empty.Count != 0 || empty.Best != nil {
+		t.Errorf("got %+v for no reviews", empty)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	since := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	now := since.AddDate(0, 0, 7)
+	s := Summarize([]render.Review{
+		{Stars: 5, Title: "Superb", ConsumerName: "@everyone", URL: "https://example.com/a"},
+		{Stars: 2, Text: "Slow delivery"},
+	})
+
+	embed := Embed(s, Summary{Count: 4, Average: 3.5}, since, now)
+	if !strings.Contains(embed.Description, "**2** reviews") || !strings.Contains(embed.Description, "3.5★") {
+		t.Errorf("got description %q", embed.Description)
+	}
+	fields := map[string]string{}
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	if !strings.Contains(fields["Change on the previous period"], "Reviews: 2 (-2)") || !strings.Contains(fields["Change on the previous period"], "(±0)") {
+		t.Errorf("got change %q", fields["Change on the previous period"])
+	}
+	if !strings.Contains(fields["Best"], "[Superb](https://example.com/a)") || strings.Contains(fields["Best"], "@everyone") {
+		t.Errorf("got best %q", fields["Best"])
+	}
+	if !strings.Contains(fields["Worst"], "Slow delivery") {
+		t.Errorf("got worst %q", fields["Worst"])
+	}
+
+	quiet := Embed(Summary{}, s, since, now)
+	if len(quiet.Fields) != 0 || !strings.HasPrefix(quiet.Description, "No new reviews") {
+		t.Errorf("got %+v for a quiet period", quiet)
+	}
+}
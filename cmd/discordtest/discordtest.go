@@ -0,0 +1,266 @@
+// Package discordtest provides a fake Discord session that records what the
+// bot sends instead of calling Discord.
+package discordtest
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Response is an interaction response the bot made.
+type Response struct {
+	Interaction *discordgo.Interaction
+	Response    *discordgo.InteractionResponse
+}
+
+// Followup is a follow-up message the bot sent for an interaction.
+type Followup struct {
+	Interaction *discordgo.Interaction
+	Params      *discordgo.WebhookParams
+}
+
+// Send is a message the bot sent to a channel.
+type Send struct {
+	ChannelID string
+	Message   *discordgo.MessageSend
+}
+
+// Thread is a thread the bot started on a message, or a post it made in a
+// forum, which has no MessageID but a Message.
+type Thread struct {
+	ChannelID string
+	MessageID string
+	Start     *discordgo.ThreadStart
+	Message   *discordgo.MessageSend
+	// ID is the ID the fake gave the thread
+	ID string
+}
+
+// Edit is a change the bot made to a channel or thread.
+type Edit struct {
+	ChannelID string
+	Edit      *discordgo.ChannelEdit
+}
+
+// Session records every call made through it. Set the Err fields to make
+// the matching calls fail. It is safe for concurrent use.
+type Session struct {
+	mu        sync.Mutex
+	responses []Response
+	followups []Followup
+	sends     []Send
+	threads   []Thread
+	edits     []Edit
+	channels  map[string]*discordgo.Channel
+	commands  map[string][]*discordgo.ApplicationCommand
+	nextID    int
+
+	RespondErr  error
+	FollowupErr error
+	SendErr     error
+	ThreadErr   error
+	EditErr     error
+}
+
+// NewSession returns an empty fake session.
+func NewSession() *Session {
+	return &Session{
+		channels: map[string]*discordgo.Channel{},
+		commands: map[string][]*discordgo.ApplicationCommand{},
+	}
+}
+
+func (s *Session) id() string {
+	s.nextID++
+	return strconv.Itoa(s.nextID)
+}
+
+func (s *Session) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.RespondErr != nil {
+		return s.RespondErr
+	}
+	s.responses = append(s.responses, Response{interaction, resp})
+	return nil
+}
+
+func (s *Session) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.FollowupErr != nil {
+		return nil, s.FollowupErr
+	}
+	s.followups = append(s.followups, Followup{interaction, data})
+	return &discordgo.Message{ID: s.id(), ChannelID: interaction.ChannelID, Content: data.Content}, nil
+}
+
+func (s *Session) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.SendErr != nil {
+		return nil, s.SendErr
+	}
+	s.sends = append(s.sends, Send{channelID, data})
+	return &discordgo.Message{ID: s.id(), ChannelID: channelID, Content: data.Content, Embeds: data.Embeds}, nil
+}
+
+// AddChannel makes channel known to the fake, for Channel to return.
+func (s *Session) AddChannel(channel *discordgo.Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *channel
+	s.channels[channel.ID] = &copied
+}
+
+func (s *Session) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel, ok := s.channels[channelID]
+	if !ok {
+		return nil, fmt.Errorf("unknown channel %s", channelID)
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+func (s *Session) ForumThreadStartComplex(channelID string, threadData *discordgo.ThreadStart, messageData *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ThreadErr != nil {
+		return nil, s.ThreadErr
+	}
+	thread := Thread{ChannelID: channelID, Start: threadData, Message: messageData, ID: s.id()}
+	s.threads = append(s.threads, thread)
+	post := &discordgo.Channel{ID: thread.ID, ParentID: channelID, Name: threadData.Name, Type: discordgo.ChannelTypeGuildPublicThread, AppliedTags: threadData.AppliedTags}
+	s.channels[post.ID] = post
+	copied := *post
+	return &copied, nil
+}
+
+func (s *Session) MessageThreadStartComplex(channelID string, messageID string, data *discordgo.ThreadStart, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ThreadErr != nil {
+		return nil, s.ThreadErr
+	}
+	thread := Thread{ChannelID: channelID, MessageID: messageID, Start: data, ID: s.id()}
+	s.threads = append(s.threads, thread)
+	return &discordgo.Channel{ID: thread.ID, ParentID: channelID, Name: data.Name, Type: discordgo.ChannelTypeGuildPublicThread}, nil
+}
+
+func (s *Session) ChannelEditComplex(channelID string, data *discordgo.ChannelEdit, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.EditErr != nil {
+		return nil, s.EditErr
+	}
+	s.edits = append(s.edits, Edit{channelID, data})
+	channel, ok := s.channels[channelID]
+	if !ok {
+		return &discordgo.Channel{ID: channelID, Name: data.Name}, nil
+	}
+	if data.Name != "" {
+		channel.Name = data.Name
+	}
+	if data.AvailableTags != nil {
+		channel.AvailableTags = nil
+		for _, tag := range *data.AvailableTags {
+			if tag.ID == "" {
+				tag.ID = s.id()
+			}
+			channel.AvailableTags = append(channel.AvailableTags, tag)
+		}
+	}
+	if data.AppliedTags != nil {
+		channel.AppliedTags = *data.AppliedTags
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+func (s *Session) ApplicationCommands(appID string, guildID string, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*discordgo.ApplicationCommand{}, s.commands[guildID]...), nil
+}
+
+func (s *Session) ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	registered := make([]*discordgo.ApplicationCommand, len(commands))
+	for n, cmd := range commands {
+		copied := *cmd
+		copied.ID = s.id()
+		copied.ApplicationID = appID
+		registered[n] = &copied
+	}
+	s.commands[guildID] = registered
+	return registered, nil
+}
+
+// Responses returns the interaction responses made so far.
+func (s *Session) Responses() []Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Response{}, s.responses...)
+}
+
+// Followups returns the follow-up messages sent so far.
+func (s *Session) Followups() []Followup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Followup{}, s.followups...)
+}
+
+// Sends returns the channel messages sent so far.
+func (s *Session) Sends() []Send {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Send{}, s.sends...)
+}
+
+// Threads returns the threads started so far.
+func (s *Session) Threads() []Thread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Thread{}, s.threads...)
+}
+
+// Edits returns the channel edits made so far.
+func (s *Session) Edits() []Edit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Edit{}, s.edits...)
+}
+
+// Interaction builds an interaction from a member of guildID with the given
+// permissions, for passing to a handler.
+func Interaction(guildID string, permissions int64, data discordgo.InteractionData) *discordgo.InteractionCreate {
+	i := &discordgo.Interaction{
+		ID:        "interaction-1",
+		GuildID:   guildID,
+		ChannelID: "channel-1",
+		Data:      data,
+		Member: &discordgo.Member{
+			User:        &discordgo.User{ID: "user-1", Username: "tester"},
+			Permissions: permissions,
+		},
+	}
+	switch data.(type) {
+	case discordgo.ApplicationCommandInteractionData:
+		i.Type = discordgo.InteractionApplicationCommand
+	case discordgo.MessageComponentInteractionData:
+		i.Type = discordgo.InteractionMessageComponent
+	case discordgo.ModalSubmitInteractionData:
+		i.Type = discordgo.InteractionModalSubmit
+	}
+	if guildID == "" {
+		i.User = i.Member.User
+		i.Member = nil
+	}
+	return &discordgo.InteractionCreate{Interaction: i}
+}
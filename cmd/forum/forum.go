@@ -0,0 +1,116 @@
+// Package forum maps reviews onto the tags of forum channels they are
+// posted in, and keeps their status tags in step as they are handled.
+package forum
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// Statuses a review's forum post moves through.
+const (
+	StatusOpen      = "Open"
+	StatusEscalated = "Escalated"
+	StatusReplied   = "Replied"
+)
+
+// Statuses are the status tags, of which a post has one at a time.
+var Statuses = []string{StatusOpen, StatusEscalated, StatusReplied}
+
+// Discord's limits on forum tags.
+const (
+	MaxAvailableTags = 20
+	MaxAppliedTags   = 5
+)
+
+// StarTag is the name of the tag for a rating, like "2★".
+func StarTag(stars int) string {
+	return fmt.Sprintf("%d★", min(max(stars, 1), 5))
+}
+
+// BotTags are the tags the bot needs on a forum: a status tag for each
+// status and a tag for each rating.
+func BotTags() []string {
+	tags := append([]string{}, Statuses...)
+	for stars := 5; stars >= 1; stars-- {
+		tags = append(tags, StarTag(stars))
+	}
+	return tags
+}
+
+// TagNames are the names of the tags a review's post should have, most
+// important first: its status, its rating and then its Trustpilot tags,
+// which match forum tags named after either the value or "group: value".
+func TagNames(r render.Review, status string) []string {
+	names := []string{status, StarTag(r.Stars)}
+	for _, tag := range r.Tags {
+		names = append(names, tag.Group+": "+tag.Value, tag.Value)
+	}
+	return names
+}
+
+// findTag returns the ID of the tag in available named name, ignoring case.
+func findTag(available []discordgo.ForumTag, name string) (string, bool) {
+	for _, tag := range available {
+		if strings.EqualFold(tag.Name, name) {
+			return tag.ID, true
+		}
+	}
+	return "", false
+}
+
+// TagIDs returns the IDs of the tags in available with names, in order of
+// names, as many as a post can have. Names the forum has no tag for are skipped.
+func TagIDs(available []discordgo.ForumTag, names []string) []string {
+	var ids []string
+	for _, name := range names {
+		id, ok := findTag(available, name)
+		if ok && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+		if len(ids) == MaxAppliedTags {
+			break
+		}
+	}
+	return ids
+}
+
+// WithStatus returns applied, a post's tags, with its status tag changed to status.
+func WithStatus(available []discordgo.ForumTag, applied []string, status string) []string {
+	var statusIDs []string
+	for _, name := range Statuses {
+		if id, ok := findTag(available, name); ok {
+			statusIDs = append(statusIDs, id)
+		}
+	}
+
+	result := []string{}
+	if id, ok := findTag(available, status); ok {
+		result = append(result, id)
+	}
+	for _, id := range applied {
+		if !slices.Contains(statusIDs, id) && len(result) < MaxAppliedTags {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// MissingTags returns available with the bot's tags it lacks added, and
+// whether any were. Tags that don't fit within MaxAvailableTags are left out.
+func MissingTags(available []discordgo.ForumTag) ([]discordgo.ForumTag, bool) {
+	result := append([]discordgo.ForumTag{}, available...)
+	added := false
+	for _, name := range BotTags() {
+		if _, ok := findTag(result, name); ok || len(result) == MaxAvailableTags {
+			continue
+		}
+		result = append(result, discordgo.ForumTag{Name: name})
+		added = true
+	}
+	return result, added
+}
@@ -0,0 +1,70 @@
+package forum
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+var available = []discordgo.ForumTag{
+	{ID: "open", Name: "Open"},
+	{ID: "escalated", Name: "Escalated"},
+	{ID: "replied", Name: "Replied"},
+	{ID: "one", Name: "1★"},
+	{ID: "five", Name: "5★"},
+	{ID: "delivery", Name: "Delivery"},
+	{ID: "invited", Name: "source: invitation"},
+}
+
+func TestTagIDs(t *testing.T) {
+	review := render.Review{Stars: 1, Tags: []render.Tag{
+		{Group: "topic", Value: "delivery"},
+		{Group: "source", Value: "invitation"},
+		{Group: "topic", Value: "price"},
+	}}
+
+	got := TagIDs(available, TagNames(review, StatusOpen))
+	if want := []string{"open", "one", "delivery", "invited"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTagIDsKeepsToDiscordsLimit(t *testing.T) {
+	var tags []discordgo.ForumTag
+	var names []string
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		tags = append(tags, discordgo.ForumTag{ID: name, Name: name})
+		names = append(names, name)
+	}
+	if got := TagIDs(tags, names); len(got) != MaxAppliedTags || got[0] != "a" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestWithStatus(t *testing.T) {
+	got := WithStatus(available, []string{"escalated", "one", "delivery"}, StatusReplied)
+	if want := []string{"replied", "one", "delivery"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMissingTags(t *testing.T) {
+	tags, added := MissingTags([]discordgo.ForumTag{{ID: "x", Name: "open"}, {ID: "y", Name: "Shipping"}})
+	if !added {
+		t.Fatal("nothing added")
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	want := []string{"open", "Shipping", "Escalated", "Replied", "5★", "4★", "3★", "2★", "1★"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	if _, added := MissingTags(tags); added {
+		t.Error("added tags a second time")
+	}
+}
@@ -1,17 +1,26 @@
 package handlers
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
 )
 
-func createDropdowns(i *discordgo.InteractionCreate, state SharedState) *discordgo.InteractionResponseData {
-	buids := state.GetBuids()
+// createDropdowns lets a guild pick one of its business units and then the
+// channels to post its reviews in. selected is the business unit picked so
+// far, which the channel select carries in its custom ID.
+func createDropdowns(i *discordgo.InteractionCreate, state SharedState, selected string) *discordgo.InteractionResponseData {
+	link, _ := state.GetTrustpilotLink(i.GuildID)
+	buids := link.BusinessUnits
+	if selected == "" && len(buids) == 1 {
+		selected = buids[0].ID
+	}
+	channelSelectID := "channel-select"
+	if selected != "" {
+		channelSelectID = CustomID("channel-select", selected)
+	}
+
 	var dropdowns []discordgo.SelectMenuOption
-	fmt.Println("Creating dropdowns for business units:", buids)
-	fmt.Println("Creating dropdowns for business units:", len(buids))
+	interactionLogger(i).Debug("creating dropdowns for business units", "business_units", len(buids))
 	if len(buids) == 0 {
 		dropdowns = []discordgo.SelectMenuOption{
 			{
@@ -25,16 +34,16 @@ func createDropdowns(i *discordgo.InteractionCreate, state SharedState) *discord
 		dropdowns = make([]discordgo.SelectMenuOption, len(buids))
 		for i, buid := range buids {
 			dropdowns[i] = discordgo.SelectMenuOption{
-				Label:       buid,
-				Value:       buid,
-				Description: "Business Unit: " + buid,
-				Default:     false,
+				Label:       buid.Name,
+				Value:       buid.ID,
+				Description: "Business Unit: " + buid.ID,
+				Default:     buid.ID == selected,
 			}
 		}
 	}
 
 	return &discordgo.InteractionResponseData{
-		Content: "Lets take a look at these settings" + i.Interaction.Member.User.ID,
+		Content: "Lets take a look at these settings" + InteractionUser(i).ID,
 		Flags:   discordgo.MessageFlagsEphemeral,
 		Components: []discordgo.MessageComponent{
 			discordgo.ActionsRow{
@@ -50,11 +59,12 @@ func createDropdowns(i *discordgo.InteractionCreate, state SharedState) *discord
 			discordgo.ActionsRow{
 				Components: []discordgo.MessageComponent{
 					discordgo.SelectMenu{
-						CustomID:    "channel-select",
+						CustomID:    channelSelectID,
 						Placeholder: "Select a channel",
 						MenuType:    discordgo.ChannelSelectMenu,
 						ChannelTypes: []discordgo.ChannelType{
 							discordgo.ChannelTypeGuildText,
+							discordgo.ChannelTypeGuildForum,
 						},
 					},
 				},
@@ -63,80 +73,152 @@ func createDropdowns(i *discordgo.InteractionCreate, state SharedState) *discord
 	}
 }
 
-var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState){
-	"settings": func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: createDropdowns(i, state),
-		})
+// configPermissions hides the configuration commands from members without
+// Manage Server by default; guilds can loosen this in their integration
+// settings and with /permissions.
+var configPermissions = DefaultCommandPermissions
 
-		if err != nil {
-			fmt.Println("Error responding to interaction: ", err)
-			return
-		}
-	},
-	"test": func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Test command executed",
-			},
-		})
-	},
-	"modal": func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Test command executed",
-			},
-		})
-	},
-	"login": func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-		// respond with a button to open a website
-		fmt.Println("Login command executed by:", i.Interaction.Member.User.Username)
-		baseUrl := "https://authenticate.tp-staging.com/?redirect_uri="
-		redirectUrl := "http://localhost:8080/auth" // Replace with your redirect URL
-		// load in client id from env
-		clientId := os.Getenv("CLIENT_ID")
-		queryParams := fmt.Sprintf("&client_id=%s&response_type=token", clientId)
-		serverIdQueryParams := fmt.Sprintf("&guild_id=%s", i.Interaction.GuildID)
-		fullUrl := baseUrl + redirectUrl + queryParams + serverIdQueryParams
+// commands are the slash commands the bot registers and handles.
+func commands(cfg *config.Config) []*Command {
+	return []*Command{
+		{
+			Name:        "settings",
+			Description: "Open the settings modal",
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     settingsCommand,
+		},
+		{
+			Name:        "login",
+			Description: "Login to the bot",
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     loginCommand(cfg),
+		},
+		{
+			Name:        "permissions",
+			Description: "Choose which roles can change the bot's settings",
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			// Only Manage Server may hand out access, so configured roles can't grant themselves more
+			Middlewares: []InteractionMiddleware{RequireManageServer},
+			Handler:     permissionsCommand,
+		},
+		{
+			Name:        "template",
+			Description: "Customise how reviews are laid out",
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     templateCommand,
+		},
+		{
+			Name:        "filters",
+			Description: "Choose which reviews each channel gets",
+			Options:     filtersOptions(),
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     filtersCommand,
+		},
+		{
+			Name:        "mentions",
+			Description: "Ping roles or members about the reviews that need them",
+			Options:     mentionsOptions(),
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     mentionsCommand,
+		},
+		{
+			Name:        "threads",
+			Description: "Start a thread on each review posted in a channel, for discussing it",
+			Options:     threadsOptions(),
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     threadsCommand,
+		},
+		{
+			Name:        "digest",
+			Description: "Post a daily or weekly summary of a channel's reviews",
+			Options:     digestOptions(),
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     digestCommand,
+		},
+		{
+			Name:        "trustscore",
+			Description: "Show a business unit's TrustScore and ratings on Trustpilot",
+			Options:     trustscoreOptions(),
+			GuildOnly:   true,
+			Handler:     trustscoreCommand(cfg),
+		},
+		{
+			Name:        "stats",
+			Description: "Summarise the reviews received over a period",
+			Options:     statsOptions(),
+			GuildOnly:   true,
+			Handler:     statsCommand,
+		},
+		{
+			Name:        "reviews",
+			Description: "Search the reviews received",
+			Options:     reviewsOptions(),
+			GuildOnly:   true,
+			Handler:     reviewsCommand,
+		},
+		{
+			Name:        "sla",
+			Description: "Remind a channel about reviews nobody has replied to in time",
+			Options:     slaOptions(),
+			Permissions: &configPermissions,
+			GuildOnly:   true,
+			Protected:   true,
+			Handler:     slaCommand,
+		},
+		{
+			Name:        "backlog",
+			Description: "List the reviews waiting too long for a reply, oldest first",
+			Options:     backlogOptions(),
+			GuildOnly:   true,
+			Handler:     backlogCommand,
+		},
+	}
+}
 
-		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Login to the bot",
-				Flags:   discordgo.MessageFlagsEphemeral,
-				Components: []discordgo.MessageComponent{
-					discordgo.ActionsRow{
-						Components: []discordgo.MessageComponent{
-							discordgo.Button{
-								Label: "Login",
-								Style: discordgo.LinkButton,
-								URL:   fullUrl, // Replace with your login URL
-							},
-						},
-					},
-				},
-			},
-		})
-		if err != nil {
-			fmt.Println("Error responding to login command:", err)
-			return
-		}
-	},
+// NewCommandRouter returns a router for every command, component and modal
+// the bot handles, wrapped in middlewares.
+func NewCommandRouter(cfg *config.Config, middlewares ...InteractionMiddleware) *Router {
+	router := NewRouter(middlewares...)
+	router.AddCommand(commands(cfg)...)
+	router.AddComponent(components(cfg)...)
+	router.AddModal(modals(cfg)...)
+	return router
 }
 
-func CommandHandler(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-	fmt.Printf("command: '%s' from %s\n", i.ApplicationCommandData().Name, i.Interaction.Member.User.Username)
-	if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
-		h(s, i, state)
-	} else {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Unknown Command",
-			},
-		})
+func settingsCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: createDropdowns(i, state, ""),
+	})
+
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to settings command", "error", err)
+		return
+	}
+}
+
+func permissionsCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: createRoleSelect(i, state),
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to permissions command", "error", err)
+		return
 	}
 }
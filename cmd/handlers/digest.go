@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/digest"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
+
+// digestOptions are the /digest subcommands.
+func digestOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "set",
+			Description: "Post a summary of a channel's reviews on a schedule",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to post digests in"),
+				{Type: discordgo.ApplicationCommandOptionString, Name: "schedule", Description: "daily, weekly or a cron expression like 0 9 * * 1", Required: true},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "timezone", Description: "Timezone of the schedule, like Europe/London, UTC if empty"},
+				{Type: discordgo.ApplicationCommandOptionBoolean, Name: "only", Description: "Only post digests, instead of each review as it arrives"},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "off",
+			Description: "Stop posting digests in a channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to stop digests in"),
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "preview",
+			Description: "Show what a channel's next digest looks like so far",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to preview"),
+			},
+		},
+	}
+}
+
+func digestCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) != 1 {
+		respondEphemeral(s, i, "Pick one of set, off or preview.")
+		return
+	}
+	subcommand := data.Options[0]
+	options := commandOptions(subcommand.Options)
+
+	switch subcommand.Name {
+	case "set":
+		setDigest(s, i, state, options)
+	case "off":
+		channelID := idOption(options["channel"])
+		if !state.SetRouteDigest(i.GuildID, channelID, routing.Digest{}) {
+			respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> won't get digests, and reviews will be posted as they arrive.", channelID))
+	case "preview":
+		previewDigest(s, i, state, options)
+	default:
+		respondEphemeral(s, i, "Unknown digest command")
+	}
+}
+
+func setDigest(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	d := routing.Digest{Schedule: options["schedule"].StringValue()}
+	if option, ok := options["timezone"]; ok {
+		d.Timezone = option.StringValue()
+	}
+	if option, ok := options["only"]; ok {
+		d.Only = option.BoolValue()
+	}
+
+	schedule, err := digest.ParseSchedule(d.Schedule)
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("That schedule doesn't work: %s.", err))
+		return
+	}
+	location, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("%q isn't a timezone, try one like Europe/London.", d.Timezone))
+		return
+	}
+	next := schedule.Next(time.Now().In(location))
+	if next.IsZero() {
+		respondEphemeral(s, i, "That schedule never runs.")
+		return
+	}
+	if !state.SetRouteDigest(i.GuildID, channelID, d) {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+
+	posting := "Reviews will still be posted as they arrive."
+	if d.Only {
+		posting = "Reviews will only appear in the digest."
+	}
+	respondEphemeral(s, i, fmt.Sprintf("<#%s> will get a digest on `%s`, next <t:%d:F>. %s", channelID, d.Schedule, next.Unix(), posting))
+}
+
+func previewDigest(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	route, ok := guildRoute(state, i.GuildID, channelID)
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+	if route.Digest.IsZero() {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> doesn't get digests, turn them on with `/digest set`.", channelID))
+		return
+	}
+
+	period := state.GetDigestPeriod(channelID)
+	embed := digest.Embed(digest.Summarize(period.Reviews), period.Previous, period.Since, time.Now())
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         fmt.Sprintf("The digest for <#%s> so far:", channelID),
+			Embeds:          []*discordgo.MessageEmbed{embed},
+			Flags:           discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to digest preview", "error", err)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
+
+const (
+	// defaultPreviewCount is how many recent reviews /filters test checks by default
+	defaultPreviewCount = 10
+	maxPreviewCount     = 50
+	// previewLines caps the matching reviews listed, to stay within a message
+	previewLines = 10
+)
+
+var (
+	minStars = 1.0
+	minCount = 1.0
+)
+
+func filterChannelOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionChannel,
+		Name:         "channel",
+		Description:  description,
+		Required:     true,
+		ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildForum},
+	}
+}
+
+// filtersOptions are the /filters subcommands.
+func filtersOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "set",
+			Description: "Choose which reviews a channel gets, replacing its current filter",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Channel to filter reviews for"),
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "min_stars", Description: "Lowest rating to post", MinValue: &minStars, MaxValue: 5},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "max_stars", Description: "Highest rating to post", MinValue: &minStars, MaxValue: 5},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "languages", Description: "Comma separated language codes, like en,de"},
+				{Type: discordgo.ApplicationCommandOptionBoolean, Name: "verified_only", Description: "Only post verified reviews"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "tags", Description: "Comma separated tag groups or group=value, any of which must match"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "include", Description: "Comma separated keywords, one of which must be mentioned"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "exclude", Description: "Comma separated keywords that stop a review being posted"},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "show",
+			Description: "List the review channels and their filters",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "clear",
+			Description: "Post every review in a channel again",
+			Options:     []*discordgo.ApplicationCommandOption{filterChannelOption("Channel to clear the filter for")},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "test",
+			Description: "See which recent reviews a channel's filter lets through",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Channel whose filter to test"),
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "count", Description: "How many recent reviews to test", MinValue: &minCount, MaxValue: maxPreviewCount},
+			},
+		},
+	}
+}
+
+// commandOptions returns a command's options by name.
+func commandOptions(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	result := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		result[option.Name] = option
+	}
+	return result
+}
+
+// idOption returns the ID picked for a channel, role or user option.
+func idOption(option *discordgo.ApplicationCommandInteractionDataOption) string {
+	id, _ := option.Value.(string)
+	return id
+}
+
+func filtersCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) != 1 {
+		respondEphemeral(s, i, "Pick one of set, show, clear or test.")
+		return
+	}
+	subcommand := data.Options[0]
+	options := commandOptions(subcommand.Options)
+
+	switch subcommand.Name {
+	case "set":
+		setFilter(s, i, state, options)
+	case "show":
+		showFilters(s, i, state)
+	case "clear":
+		clearFilter(s, i, state, options)
+	case "test":
+		testFilter(s, i, state, options)
+	default:
+		respondEphemeral(s, i, "Unknown filters command")
+	}
+}
+
+func setFilter(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	var filter routing.Filter
+	if option, ok := options["min_stars"]; ok {
+		filter.MinStars = int(option.IntValue())
+	}
+	if option, ok := options["max_stars"]; ok {
+		filter.MaxStars = int(option.IntValue())
+	}
+	if option, ok := options["languages"]; ok {
+		filter.Languages = routing.ParseList(option.StringValue())
+	}
+	if option, ok := options["verified_only"]; ok {
+		filter.VerifiedOnly = option.BoolValue()
+	}
+	if option, ok := options["tags"]; ok {
+		filter.Tags = routing.ParseTags(option.StringValue())
+	}
+	if option, ok := options["include"]; ok {
+		filter.Include = routing.ParseList(option.StringValue())
+	}
+	if option, ok := options["exclude"]; ok {
+		filter.Exclude = routing.ParseList(option.StringValue())
+	}
+	if err := filter.Validate(); err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("That filter can't match anything: %s.", err))
+		return
+	}
+
+	channelID := idOption(options["channel"])
+	if !state.SetRouteFilter(i.GuildID, channelID, filter) {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel, pick it with /settings first.", channelID))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("<#%s> will get %s. Try it with `/filters test`.", channelID, filter))
+}
+
+func showFilters(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	routes := state.GetGuildRoutes(i.GuildID)
+	if len(routes) == 0 {
+		respondEphemeral(s, i, "No review channels yet, pick some with /settings.")
+		return
+	}
+
+	lines := make([]string, len(routes))
+	for n, route := range routes {
+		lines[n] = fmt.Sprintf("<#%s>: %s", route.ChannelID, route.Filter)
+	}
+	respondEphemeral(s, i, render.Truncate(strings.Join(lines, "\n"), render.MaxContent))
+}
+
+// guildRoute returns the route to channelID in guildID.
+func guildRoute(state SharedState, guildID string, channelID string) (routing.Route, bool) {
+	for _, route := range state.GetGuildRoutes(guildID) {
+		if route.ChannelID == channelID {
+			return route, true
+		}
+	}
+	return routing.Route{}, false
+}
+
+func clearFilter(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	if _, ok := guildRoute(state, i.GuildID, channelID); !ok {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+	state.SetRouteFilter(i.GuildID, channelID, routing.Filter{})
+	respondEphemeral(s, i, fmt.Sprintf("<#%s> will get every review.", channelID))
+}
+
+func testFilter(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	route, ok := guildRoute(state, i.GuildID, channelID)
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+	count := defaultPreviewCount
+	if option, ok := options["count"]; ok {
+		count = int(option.IntValue())
+	}
+
+	if route.BusinessUnitID == "" {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> has no business unit yet, pick one in /settings.", channelID))
+		return
+	}
+	reviews := state.GetRecentReviews(route.BusinessUnitID, count)
+	if len(reviews) == 0 {
+		respondEphemeral(s, i, "No reviews have come in yet to test against.")
+		return
+	}
+
+	var matched []string
+	for _, review := range reviews {
+		if route.Matches(review) {
+			summary := review.Title
+			if summary == "" {
+				summary = review.Text
+			}
+			matched = append(matched, fmt.Sprintf("%s %s", review.StarBar(), render.Escape(render.Truncate(summary, 80))))
+		}
+	}
+
+	content := fmt.Sprintf("<#%s> gets %s.\n%d of the last %d reviews would have been posted there", channelID, route.Filter, len(matched), len(reviews))
+	if len(matched) > 0 {
+		content += ":\n" + strings.Join(matched[:min(len(matched), previewLines)], "\n")
+		if len(matched) > previewLines {
+			content += fmt.Sprintf("\n…and %d more", len(matched)-previewLines)
+		}
+	} else {
+		content += "."
+	}
+	respondEphemeral(s, i, render.Truncate(content, render.MaxContent))
+}
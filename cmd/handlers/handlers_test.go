@@ -0,0 +1,1032 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/digest"
+	"github.com/liukaku/discord-tp/cmd/discordtest"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/metrics"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+	"github.com/liukaku/discord-tp/cmd/trustpilottest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// fakeState is an in-memory SharedState.
+type fakeState struct {
+	sync.Mutex
+	routes       []routing.Route
+	recent       map[string][]render.Review
+	allowedRoles map[string][]string
+	links        map[string]types.TrustpilotLink
+	templates    map[string]render.Template
+	threads      map[string][]types.ReviewThread
+	digests      map[string]digest.Period
+	history      *history.Store
+	searches     map[string]history.Query
+}
+
+func newFakeState() *fakeState {
+	return &fakeState{
+		allowedRoles: map[string][]string{},
+		links:        map[string]types.TrustpilotLink{},
+		templates:    map[string]render.Template{},
+		threads:      map[string][]types.ReviewThread{},
+		digests:      map[string]digest.Period{},
+		history:      history.NewStore(),
+		searches:     map[string]history.Query{},
+	}
+}
+
+func (f *fakeState) AddRoutes(routes ...routing.Route) {
+	f.Lock()
+	defer f.Unlock()
+	f.routes = append(f.routes, routes...)
+}
+
+func (f *fakeState) GetGuildRoutes(guildID string) []routing.Route {
+	f.Lock()
+	defer f.Unlock()
+	var result []routing.Route
+	for _, route := range f.routes {
+		if route.GuildID == guildID {
+			result = append(result, route)
+		}
+	}
+	return result
+}
+
+func (f *fakeState) SetRouteFilter(guildID string, channelID string, filter routing.Filter) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil {
+		return false
+	}
+	route.Filter = filter
+	return true
+}
+
+// guildRoute returns the route to channelID in guildID. It must be called
+// with the lock held.
+func (f *fakeState) guildRoute(guildID string, channelID string) *routing.Route {
+	for n, route := range f.routes {
+		if route.GuildID == guildID && route.ChannelID == channelID {
+			return &f.routes[n]
+		}
+	}
+	return nil
+}
+
+func (f *fakeState) AddMentionRule(guildID string, channelID string, rule routing.MentionRule) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil {
+		return false
+	}
+	route.MentionRules = append(route.MentionRules, rule)
+	return true
+}
+
+func (f *fakeState) RemoveMentionRule(guildID string, channelID string, index int) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil || index < 0 || index >= len(route.MentionRules) {
+		return false
+	}
+	route.MentionRules = append(route.MentionRules[:index], route.MentionRules[index+1:]...)
+	return true
+}
+
+func (f *fakeState) SetQuietHours(guildID string, channelID string, quiet routing.QuietHours) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil {
+		return false
+	}
+	route.QuietHours = quiet
+	return true
+}
+
+func (f *fakeState) SetRouteThreads(guildID string, channelID string, threads bool) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil {
+		return false
+	}
+	route.Threads = threads
+	return true
+}
+
+func (f *fakeState) SetRouteDigest(guildID string, channelID string, d routing.Digest) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil {
+		return false
+	}
+	route.Digest = d
+	return true
+}
+
+func (f *fakeState) SetRouteReplySLA(guildID string, channelID string, sla routing.ReplySLA) bool {
+	f.Lock()
+	defer f.Unlock()
+	route := f.guildRoute(guildID, channelID)
+	if route == nil {
+		return false
+	}
+	route.ReplySLA = sla
+	return true
+}
+
+func (f *fakeState) GetDigestPeriod(channelID string) digest.Period {
+	f.Lock()
+	defer f.Unlock()
+	return f.digests[channelID]
+}
+
+func (f *fakeState) GetReviewThreads(reviewID string) []types.ReviewThread {
+	f.Lock()
+	defer f.Unlock()
+	return append([]types.ReviewThread{}, f.threads[reviewID]...)
+}
+
+func (f *fakeState) RemoveReviewThread(reviewID string, threadID string) {
+	f.Lock()
+	defer f.Unlock()
+	var kept []types.ReviewThread
+	for _, thread := range f.threads[reviewID] {
+		if thread.ThreadID != threadID {
+			kept = append(kept, thread)
+		}
+	}
+	f.threads[reviewID] = kept
+}
+
+func (f *fakeState) GetRecentReviews(businessUnitID string, n int) []render.Review {
+	f.Lock()
+	defer f.Unlock()
+	recent := f.recent[businessUnitID]
+	return append([]render.Review{}, recent[:min(n, len(recent))]...)
+}
+
+func (f *fakeState) SearchReviews(q history.Query) []history.Record {
+	return f.history.Search(q)
+}
+
+func (f *fakeState) MarkReviewReplied(reviewID string) {
+	f.history.MarkReplied(reviewID, time.Now())
+}
+
+func (f *fakeState) SaveSearch(q history.Query) string {
+	f.Lock()
+	defer f.Unlock()
+	searchID := fmt.Sprintf("search-%d", len(f.searches)+1)
+	f.searches[searchID] = q
+	return searchID
+}
+
+func (f *fakeState) GetSearch(searchID string) (history.Query, bool) {
+	f.Lock()
+	defer f.Unlock()
+	q, ok := f.searches[searchID]
+	return q, ok
+}
+
+func (f *fakeState) GetAllowedRoles(guildID string) []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string{}, f.allowedRoles[guildID]...)
+}
+
+func (f *fakeState) SetAllowedRoles(guildID string, roleIDs ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.allowedRoles[guildID] = roleIDs
+}
+
+func (f *fakeState) CreateLoginState(guildID string) string {
+	return "state-for-" + guildID
+}
+
+func (f *fakeState) GetTrustpilotLink(guildID string) (types.TrustpilotLink, bool) {
+	f.Lock()
+	defer f.Unlock()
+	link, ok := f.links[guildID]
+	return link, ok
+}
+
+func (f *fakeState) GetEmbedTemplate(guildID string) render.Template {
+	f.Lock()
+	defer f.Unlock()
+	return f.templates[guildID]
+}
+
+func (f *fakeState) SetEmbedTemplate(guildID string, t render.Template) {
+	f.Lock()
+	defer f.Unlock()
+	f.templates[guildID] = t
+}
+
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.ClientID = "client"
+	cfg.AuthURL = "https://auth.example.com"
+	cfg.APIURL = "https://api.example.com"
+	return &cfg
+}
+
+func command(name string) discordgo.ApplicationCommandInteractionData {
+	return discordgo.ApplicationCommandInteractionData{Name: name}
+}
+
+func component(customID string, values ...string) discordgo.MessageComponentInteractionData {
+	return discordgo.MessageComponentInteractionData{CustomID: customID, Values: values}
+}
+
+// onlyResponse returns the single interaction response the session recorded.
+func onlyResponse(t *testing.T, s *discordtest.Session) *discordgo.InteractionResponse {
+	t.Helper()
+	responses := s.Responses()
+	if len(responses) != 1 {
+		t.Fatalf("got %d responses, want 1", len(responses))
+	}
+	return responses[0].Response
+}
+
+// linkAcme links guild-1 to a Trustpilot account that can see the Acme
+// and Beta business units.
+func linkAcme(state *fakeState) {
+	state.links["guild-1"] = types.TrustpilotLink{BusinessUnits: []types.LinkedBusinessUnit{{ID: "bu-1", Name: "Acme"}, {ID: "bu-2", Name: "Beta"}}}
+}
+
+func TestCommandHandlerSettings(t *testing.T) {
+	s := discordtest.NewSession()
+	state := newFakeState()
+	linkAcme(state)
+
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, command("settings")), state)
+
+	resp := onlyResponse(t, s)
+	if len(resp.Data.Components) != 2 {
+		t.Fatalf("got %d component rows, want the business unit and channel selects", len(resp.Data.Components))
+	}
+	selectMenu := resp.Data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if selectMenu.CustomID != "bu-select" || selectMenu.Options[0].Label != "Acme" {
+		t.Errorf("got select %q with options %+v", selectMenu.CustomID, selectMenu.Options)
+	}
+}
+
+func TestCommandHandlerRefusesUnauthorisedMembers(t *testing.T) {
+	for _, name := range []string{"settings", "login", "permissions"} {
+		s := discordtest.NewSession()
+		NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", 0, command(name)), newFakeState())
+
+		resp := onlyResponse(t, s)
+		if resp.Data.Flags != discordgo.MessageFlagsEphemeral || !strings.Contains(resp.Data.Content, "Manage Server") {
+			t.Errorf("/%s: got %+v, want an ephemeral refusal", name, resp.Data)
+		}
+	}
+}
+
+func TestCommandHandlerAllowsConfiguredRoles(t *testing.T) {
+	s := discordtest.NewSession()
+	state := newFakeState()
+	state.allowedRoles["guild-1"] = []string{"role-1"}
+	i := discordtest.Interaction("guild-1", 0, command("login"))
+	i.Member.Roles = []string{"role-1"}
+
+	NewCommandRouter(testConfig()).Handle(s, i, state)
+
+	button := onlyResponse(t, s).Data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if !strings.HasPrefix(button.URL, "https://auth.example.com/?redirect_uri=") || !strings.Contains(button.URL, "&state=state-for-guild-1") {
+		t.Errorf("got login URL %q", button.URL)
+	}
+}
+
+func TestCommandHandlerRefusesDMs(t *testing.T) {
+	s := discordtest.NewSession()
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("", 0, command("settings")), newFakeState())
+
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "only be used in a server") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestCommandHandlerUnknownCommand(t *testing.T) {
+	s := discordtest.NewSession()
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, command("nope")), newFakeState())
+
+	if content := onlyResponse(t, s).Data.Content; content != "Unknown Command" {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestSelectHandlerTiesChannelsToBusinessUnit(t *testing.T) {
+	s := discordtest.NewSession()
+	state := newFakeState()
+	linkAcme(state)
+	router := NewCommandRouter(testConfig())
+
+	router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, component("bu-select", "bu-2")), state)
+	resp := onlyResponse(t, s)
+	channelSelect := resp.Data.Components[1].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if resp.Type != discordgo.InteractionResponseUpdateMessage || channelSelect.CustomID != "channel-select:bu-2" {
+		t.Fatalf("got response type %d with channel select %q", resp.Type, channelSelect.CustomID)
+	}
+
+	s = discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, component(channelSelect.CustomID, "channel-9")), state)
+	if len(state.routes) != 1 || state.routes[0].GuildID != "guild-1" || state.routes[0].ChannelID != "channel-9" || state.routes[0].BusinessUnitID != "bu-2" {
+		t.Errorf("got routes %v", state.routes)
+	}
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "Beta") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestSelectHandlerRefusesUnlinkedBusinessUnits(t *testing.T) {
+	state := newFakeState()
+	linkAcme(state)
+	router := NewCommandRouter(testConfig())
+
+	for _, customID := range []string{"channel-select", "channel-select:other-guilds-unit"} {
+		s := discordtest.NewSession()
+		router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, component(customID, "channel-9")), state)
+		onlyResponse(t, s)
+	}
+	if len(state.routes) != 0 {
+		t.Errorf("got routes %v", state.routes)
+	}
+}
+
+func TestSelectHandlerRoleSelectNeedsManageServer(t *testing.T) {
+	s := discordtest.NewSession()
+	state := newFakeState()
+	state.allowedRoles["guild-1"] = []string{"role-1"}
+	i := discordtest.Interaction("guild-1", 0, component("permissions-role-select", "role-2"))
+	i.Member.Roles = []string{"role-1"}
+
+	NewCommandRouter(testConfig()).Handle(s, i, state)
+
+	if roles := state.allowedRoles["guild-1"]; len(roles) != 1 || roles[0] != "role-1" {
+		t.Errorf("allowed roles changed to %v", roles)
+	}
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "Manage Server") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestReplyButtonOpensModalForReview(t *testing.T) {
+	s := discordtest.NewSession()
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, component(CustomID("reply", "review-1"))), newFakeState())
+
+	resp := onlyResponse(t, s)
+	if resp.Type != discordgo.InteractionResponseModal || resp.Data.CustomID != "reply-modal:review-1" {
+		t.Errorf("got response type %d with custom ID %q", resp.Type, resp.Data.CustomID)
+	}
+}
+
+func TestRecoverRespondsAfterPanic(t *testing.T) {
+	s := discordtest.NewSession()
+	router := NewRouter(Recover, Metrics)
+	router.AddCommand(&Command{Name: "boom", Handler: func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		panic("boom")
+	}})
+
+	panics := metrics.Interactions.WithLabelValues("guild-1", "boom", "panic")
+	before := testutil.ToFloat64(panics)
+	router.Handle(s, discordtest.Interaction("guild-1", 0, command("boom")), newFakeState())
+
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "Something went wrong") {
+		t.Errorf("got %q", content)
+	}
+	if got := testutil.ToFloat64(panics); got != before+1 {
+		t.Errorf("counted %v panics, want %v", got, before+1)
+	}
+}
+
+func TestSyncCommands(t *testing.T) {
+	s := discordtest.NewSession()
+	desired := NewCommandRouter(testConfig()).ApplicationCommands()
+
+	plan, err := SyncCommands(s, "app", "guild-1", desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Create) != len(desired) {
+		t.Errorf("first sync created %d commands, want %d", len(plan.Create), len(desired))
+	}
+
+	plan, err = SyncCommands(s, "app", "guild-1", desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Changed() {
+		t.Errorf("second sync wasn't a no-op:\n%s", plan)
+	}
+}
+
+func replySubmit(reviewID string, message string) discordgo.ModalSubmitInteractionData {
+	return discordgo.ModalSubmitInteractionData{
+		CustomID: CustomID("reply-modal", reviewID),
+		Components: []discordgo.MessageComponent{
+			&discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				&discordgo.TextInput{CustomID: "message", Value: message},
+			}},
+		},
+	}
+}
+
+func TestReplyModalPostsToTrustpilot(t *testing.T) {
+	trustpilot := trustpilottest.NewServer(t)
+	cfg := testConfig()
+	cfg.APIURL = trustpilot.URL
+	state := newFakeState()
+	state.links["guild-1"] = types.TrustpilotLink{AccessToken: trustpilottest.AccessToken, BusinessUserID: "business-user-1"}
+	state.history.Add(render.Review{ID: "review-1", Stars: 4})
+	s := discordtest.NewSession()
+
+	NewCommandRouter(cfg).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, replySubmit("review-1", "Thanks!")), state)
+
+	if record, _ := state.history.Get("review-1"); !record.Replied() {
+		t.Error("review not marked as replied")
+	}
+	replies := trustpilot.Replies()
+	if len(replies) != 1 || replies[0].ReviewID != "review-1" || replies[0].Message != "Thanks!" {
+		t.Errorf("got replies %+v", replies)
+	}
+	if followups := s.Followups(); len(followups) != 1 || followups[0].Params.Content != "Reply sent to Trustpilot." {
+		t.Errorf("got follow-ups %+v", followups)
+	}
+}
+
+func TestReplyModalResolvesReviewThreads(t *testing.T) {
+	trustpilot := trustpilottest.NewServer(t)
+	cfg := testConfig()
+	cfg.APIURL = trustpilot.URL
+	state := newFakeState()
+	state.links["guild-1"] = types.TrustpilotLink{AccessToken: trustpilottest.AccessToken, BusinessUserID: "business-user-1"}
+	state.threads["review-1"] = []types.ReviewThread{{ChannelID: "channel-1", ThreadID: "thread-1", Name: "1★ · Jane"}}
+	s := discordtest.NewSession()
+
+	NewCommandRouter(cfg).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, replySubmit("review-1", "Sorry!")), state)
+
+	edits := s.Edits()
+	if len(edits) != 1 || edits[0].ChannelID != "thread-1" {
+		t.Fatalf("got edits %+v", edits)
+	}
+	if edit := edits[0].Edit; edit.Name != "✅ Resolved · 1★ · Jane" || edit.Archived == nil || !*edit.Archived {
+		t.Errorf("thread edited to %q, archived %v", edit.Name, edit.Archived)
+	}
+	if threads := state.threads["review-1"]; len(threads) != 0 {
+		t.Errorf("still tracking %+v", threads)
+	}
+}
+
+func TestReplyModalReportsTrustpilotErrors(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError} {
+		trustpilot := trustpilottest.NewServer(t)
+		trustpilot.FailNext("/v1/private/reviews/review-1/reply", status)
+		cfg := testConfig()
+		cfg.APIURL = trustpilot.URL
+		state := newFakeState()
+		state.links["guild-1"] = types.TrustpilotLink{AccessToken: trustpilottest.AccessToken, BusinessUserID: "business-user-1"}
+		state.threads["review-1"] = []types.ReviewThread{{ChannelID: "channel-1", ThreadID: "thread-1"}}
+		s := discordtest.NewSession()
+
+		NewCommandRouter(cfg).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, replySubmit("review-1", "Thanks!")), state)
+
+		if len(trustpilot.Replies()) != 0 {
+			t.Errorf("Trustpilot %d: reply was recorded", status)
+		}
+		if followups := s.Followups(); len(followups) != 1 || !strings.Contains(followups[0].Params.Content, "didn't accept") {
+			t.Errorf("Trustpilot %d: got follow-ups %+v", status, followups)
+		}
+		if edits := s.Edits(); len(edits) != 0 {
+			t.Errorf("Trustpilot %d: threads resolved %+v", status, edits)
+		}
+	}
+}
+
+func templateSubmit(title string) discordgo.ModalSubmitInteractionData {
+	return discordgo.ModalSubmitInteractionData{
+		CustomID: "template-modal",
+		Components: []discordgo.MessageComponent{
+			&discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				&discordgo.TextInput{CustomID: "title", Value: title},
+			}},
+		},
+	}
+}
+
+func TestTemplateModalSavesValidTemplates(t *testing.T) {
+	s := discordtest.NewSession()
+	state := newFakeState()
+
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, templateSubmit("{{.StarBar}} {{.ConsumerName}}")), state)
+
+	if title := state.templates["guild-1"].Title; title != "{{.StarBar}} {{.ConsumerName}}" {
+		t.Errorf("saved title template %q", title)
+	}
+	resp := onlyResponse(t, s)
+	if len(resp.Data.Embeds) != 1 || resp.Data.Embeds[0].Title != "★★★★☆ Sam Sample" {
+		t.Errorf("got preview %+v", resp.Data.Embeds)
+	}
+}
+
+func TestTemplateModalRejectsBrokenTemplates(t *testing.T) {
+	for _, title := range []string{"{{.Stars", "{{.NoSuchField}}"} {
+		s := discordtest.NewSession()
+		state := newFakeState()
+
+		NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, templateSubmit(title)), state)
+
+		if _, ok := state.templates["guild-1"]; ok {
+			t.Errorf("%q was saved", title)
+		}
+		if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "nothing was saved") {
+			t.Errorf("%q: got %q", title, content)
+		}
+	}
+}
+
+func subcommandData(name string, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) discordgo.ApplicationCommandInteractionData {
+	return discordgo.ApplicationCommandInteractionData{
+		Name: name,
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{{
+			Name:    subcommand,
+			Type:    discordgo.ApplicationCommandOptionSubCommand,
+			Options: options,
+		}},
+	}
+}
+
+func option(name string, optionType discordgo.ApplicationCommandOptionType, value any) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: optionType, Value: value}
+}
+
+func TestFiltersSetAndTest(t *testing.T) {
+	state := newFakeState()
+	state.AddRoutes(routing.Route{GuildID: "guild-1", ChannelID: "escalations", BusinessUnitID: "bu-1"})
+	state.recent = map[string][]render.Review{
+		"bu-1": {
+			{ID: "1", Title: "Never arrived", Stars: 1, Language: "en", BusinessUnitID: "bu-1"},
+			{ID: "2", Title: "Lovely", Stars: 5, Language: "en", BusinessUnitID: "bu-1"},
+			{ID: "3", Title: "Kaputt", Stars: 2, Language: "de", BusinessUnitID: "bu-1"},
+		},
+		"bu-2": {{ID: "4", Title: "Another guild's", Stars: 1, Language: "en", BusinessUnitID: "bu-2"}},
+	}
+	router := NewCommandRouter(testConfig())
+
+	s := discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("filters", "set",
+		option("channel", discordgo.ApplicationCommandOptionChannel, "escalations"),
+		option("max_stars", discordgo.ApplicationCommandOptionInteger, 2.0),
+		option("languages", discordgo.ApplicationCommandOptionString, "en, "),
+	)), state)
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "up to 2★, en") {
+		t.Errorf("got %q", content)
+	}
+	if filter := state.routes[0].Filter; filter.MaxStars != 2 || len(filter.Languages) != 1 {
+		t.Errorf("saved filter %+v", filter)
+	}
+
+	s = discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("filters", "test",
+		option("channel", discordgo.ApplicationCommandOptionChannel, "escalations"),
+	)), state)
+	content := onlyResponse(t, s).Data.Content
+	if !strings.Contains(content, "1 of the last 3") || !strings.Contains(content, "Never arrived") || strings.Contains(content, "Kaputt") || strings.Contains(content, "Another guild's") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestFiltersSetRejectsImpossibleFilters(t *testing.T) {
+	s := discordtest.NewSession()
+	state := newFakeState()
+
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("filters", "set",
+		option("channel", discordgo.ApplicationCommandOptionChannel, "escalations"),
+		option("min_stars", discordgo.ApplicationCommandOptionInteger, 4.0),
+		option("max_stars", discordgo.ApplicationCommandOptionInteger, 2.0),
+	)), state)
+
+	if len(state.routes) != 0 {
+		t.Errorf("saved routes %+v", state.routes)
+	}
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "can't match anything") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestMentionsAddAndRemove(t *testing.T) {
+	state := newFakeState()
+	state.AddRoutes(routing.Route{GuildID: "guild-1", ChannelID: "reviews"})
+	router := NewCommandRouter(testConfig())
+
+	s := discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("mentions", "add",
+		option("channel", discordgo.ApplicationCommandOptionChannel, "reviews"),
+		option("role", discordgo.ApplicationCommandOptionRole, "support"),
+		option("max_stars", discordgo.ApplicationCommandOptionInteger, 2.0),
+	)), state)
+	resp := onlyResponse(t, s)
+	if !strings.Contains(resp.Data.Content, "<@&support> for up to 2★") {
+		t.Errorf("got %q", resp.Data.Content)
+	}
+	if resp.Data.AllowedMentions == nil || len(resp.Data.AllowedMentions.Roles) != 0 {
+		t.Errorf("reply could ping: %+v", resp.Data.AllowedMentions)
+	}
+	rules := state.routes[0].MentionRules
+	if len(rules) != 1 || rules[0].RoleIDs[0] != "support" || rules[0].Filter.MaxStars != 2 {
+		t.Fatalf("saved rules %+v", rules)
+	}
+
+	s = discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("mentions", "remove",
+		option("channel", discordgo.ApplicationCommandOptionChannel, "reviews"),
+		option("rule", discordgo.ApplicationCommandOptionInteger, 1.0),
+	)), state)
+	if len(state.routes[0].MentionRules) != 0 {
+		t.Errorf("rules left %+v", state.routes[0].MentionRules)
+	}
+}
+
+func TestMentionsQuietHours(t *testing.T) {
+	state := newFakeState()
+	state.AddRoutes(routing.Route{GuildID: "guild-1", ChannelID: "reviews"})
+	router := NewCommandRouter(testConfig())
+
+	quiet := func(options ...*discordgo.ApplicationCommandInteractionDataOption) string {
+		s := discordtest.NewSession()
+		options = append(options, option("channel", discordgo.ApplicationCommandOptionChannel, "reviews"))
+		router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("mentions", "quiet", options...)), state)
+		return onlyResponse(t, s).Data.Content
+	}
+
+	if content := quiet(option("start", discordgo.ApplicationCommandOptionString, "25:00"), option("end", discordgo.ApplicationCommandOptionString, "07:00")); !strings.Contains(content, "don't work") {
+		t.Errorf("got %q", content)
+	}
+	quiet(option("start", discordgo.ApplicationCommandOptionString, "22:00"), option("end", discordgo.ApplicationCommandOptionString, "07:00"), option("timezone", discordgo.ApplicationCommandOptionString, "Europe/London"))
+	if got := state.routes[0].QuietHours; got != (routing.QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/London"}) {
+		t.Errorf("saved quiet hours %+v", got)
+	}
+	quiet()
+	if got := state.routes[0].QuietHours; !got.IsZero() {
+		t.Errorf("quiet hours left on %+v", got)
+	}
+}
+
+func TestChannelSelectSetsUpForums(t *testing.T) {
+	s := discordtest.NewSession()
+	s.AddChannel(&discordgo.Channel{ID: "triage", Type: discordgo.ChannelTypeGuildForum, AvailableTags: []discordgo.ForumTag{{ID: "t1", Name: "Open"}}})
+	state := newFakeState()
+	linkAcme(state)
+	data := component("channel-select:bu-1", "triage", "reviews")
+	data.Resolved.Channels = map[string]*discordgo.Channel{
+		"triage":  {ID: "triage", Type: discordgo.ChannelTypeGuildForum},
+		"reviews": {ID: "reviews", Type: discordgo.ChannelTypeGuildText},
+	}
+
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, data), state)
+
+	if len(state.routes) != 2 || !state.routes[0].Forum || state.routes[1].Forum {
+		t.Errorf("got routes %+v", state.routes)
+	}
+	forum, _ := s.Channel("triage")
+	if len(forum.AvailableTags) != 8 || forum.AvailableTags[0].ID != "t1" {
+		t.Errorf("forum has tags %+v", forum.AvailableTags)
+	}
+}
+
+func TestReplyModalTagsForumPostsReplied(t *testing.T) {
+	trustpilot := trustpilottest.NewServer(t)
+	cfg := testConfig()
+	cfg.APIURL = trustpilot.URL
+	state := newFakeState()
+	state.links["guild-1"] = types.TrustpilotLink{AccessToken: trustpilottest.AccessToken, BusinessUserID: "business-user-1"}
+	state.threads["review-1"] = []types.ReviewThread{{ChannelID: "triage", ThreadID: "post-1", Name: "1★ · Jane", Forum: true}}
+	s := discordtest.NewSession()
+	s.AddChannel(&discordgo.Channel{ID: "triage", Type: discordgo.ChannelTypeGuildForum, AvailableTags: []discordgo.ForumTag{
+		{ID: "open", Name: "Open"}, {ID: "replied", Name: "Replied"}, {ID: "one", Name: "1★"},
+	}})
+	s.AddChannel(&discordgo.Channel{ID: "post-1", ParentID: "triage", AppliedTags: []string{"open", "one"}})
+
+	NewCommandRouter(cfg).Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, replySubmit("review-1", "Sorry!")), state)
+
+	post, _ := s.Channel("post-1")
+	if !reflect.DeepEqual(post.AppliedTags, []string{"replied", "one"}) {
+		t.Errorf("post tagged %v", post.AppliedTags)
+	}
+	if post.Name != "" {
+		t.Errorf("post renamed to %q", post.Name)
+	}
+}
+
+func TestDigestSetAndPreview(t *testing.T) {
+	state := newFakeState()
+	state.AddRoutes(routing.Route{GuildID: "guild-1", ChannelID: "reviews"})
+	state.digests["reviews"] = digest.Period{Reviews: []render.Review{{Stars: 4}, {Stars: 2}}}
+	router := NewCommandRouter(testConfig())
+
+	run := func(subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponse {
+		s := discordtest.NewSession()
+		options = append(options, option("channel", discordgo.ApplicationCommandOptionChannel, "reviews"))
+		router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("digest", subcommand, options...)), state)
+		return onlyResponse(t, s)
+	}
+
+	if resp := run("set", option("schedule", discordgo.ApplicationCommandOptionString, "0 25 * * *")); !strings.Contains(resp.Data.Content, "doesn't work") {
+		t.Errorf("got %q", resp.Data.Content)
+	}
+	if resp := run("set", option("schedule", discordgo.ApplicationCommandOptionString, "daily"), option("timezone", discordgo.ApplicationCommandOptionString, "Mars/Olympus")); !strings.Contains(resp.Data.Content, "isn't a timezone") {
+		t.Errorf("got %q", resp.Data.Content)
+	}
+	if state.routes[0].Digest != (routing.Digest{}) {
+		t.Fatalf("saved a bad digest %+v", state.routes[0].Digest)
+	}
+
+	resp := run("set",
+		option("schedule", discordgo.ApplicationCommandOptionString, "weekly"),
+		option("timezone", discordgo.ApplicationCommandOptionString, "Europe/London"),
+		option("only", discordgo.ApplicationCommandOptionBoolean, true),
+	)
+	if !strings.Contains(resp.Data.Content, "next <t:") {
+		t.Errorf("got %q", resp.Data.Content)
+	}
+	if got := state.routes[0].Digest; got != (routing.Digest{Schedule: "weekly", Timezone: "Europe/London", Only: true}) {
+		t.Errorf("saved digest %+v", got)
+	}
+
+	resp = run("preview")
+	if len(resp.Data.Embeds) != 1 || !strings.Contains(resp.Data.Embeds[0].Description, "**2** reviews") {
+		t.Errorf("got preview %+v", resp.Data)
+	}
+
+	run("off")
+	if !state.routes[0].Digest.IsZero() {
+		t.Errorf("digest still on: %+v", state.routes[0].Digest)
+	}
+}
+
+func TestTrustscoreCommand(t *testing.T) {
+	trustpilot := trustpilottest.NewServer(t)
+	trustpilot.BusinessUnits[0].Name.Identifying = "acme.example"
+	cfg := testConfig()
+	cfg.APIURL = trustpilot.URL
+	state := newFakeState()
+	state.links["guild-1"] = types.TrustpilotLink{AccessToken: trustpilottest.AccessToken, BusinessUserID: "business-user-1", BusinessUnits: []types.LinkedBusinessUnit{{ID: "business-unit-1", Name: "Acme"}}}
+	router := NewCommandRouter(cfg)
+
+	trustscore := func(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.WebhookParams {
+		s := discordtest.NewSession()
+		data := discordgo.ApplicationCommandInteractionData{Name: "trustscore", Options: options}
+		router.Handle(s, discordtest.Interaction("guild-1", 0, data), state)
+		followups := s.Followups()
+		if len(followups) != 1 {
+			t.Fatalf("got %d follow-ups, want 1", len(followups))
+		}
+		return followups[0].Params
+	}
+
+	params := trustscore()
+	if len(params.Embeds) != 1 {
+		t.Fatalf("got %+v", params)
+	}
+	embed := params.Embeds[0]
+	if embed.Title != "Acme" || !strings.Contains(embed.Description, "TrustScore **4.4**") || !strings.Contains(embed.Description, "from 120 reviews") {
+		t.Errorf("got embed %q: %q", embed.Title, embed.Description)
+	}
+	if !strings.HasSuffix(embed.URL, "/review/acme.example") || !strings.Contains(embed.Fields[0].Value, "5★ `████████████` 90") {
+		t.Errorf("got link %q and ratings %q", embed.URL, embed.Fields[0].Value)
+	}
+
+	for _, wanted := range []string{"acme", "business-unit-1"} {
+		if params := trustscore(option("business_unit", discordgo.ApplicationCommandOptionString, wanted)); len(params.Embeds) != 1 || params.Embeds[0].Title != "Acme" {
+			t.Errorf("got %+v for %q", params, wanted)
+		}
+	}
+
+	s := discordtest.NewSession()
+	data := discordgo.ApplicationCommandInteractionData{Name: "trustscore", Options: []*discordgo.ApplicationCommandInteractionDataOption{option("business_unit", discordgo.ApplicationCommandOptionString, "Other")}}
+	router.Handle(s, discordtest.Interaction("guild-1", 0, data), state)
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "no business unit") {
+		t.Errorf("got %q for an unknown business unit", content)
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	now := time.Now()
+	state := newFakeState()
+	for _, review := range []render.Review{
+		{ID: "a", Stars: 5, BusinessUnit: "Acme", BusinessUnitID: "bu-1", CreatedAt: now.Add(-time.Hour)},
+		{ID: "b", Stars: 2, BusinessUnit: "Acme", BusinessUnitID: "bu-1", CreatedAt: now.AddDate(0, 0, -3)},
+		{ID: "c", Stars: 4, BusinessUnit: "Beta", BusinessUnitID: "bu-2", CreatedAt: now.AddDate(0, 0, -3)},
+		{ID: "d", Stars: 1, BusinessUnit: "Acme", BusinessUnitID: "bu-1", CreatedAt: now.AddDate(0, 0, -60)},
+		{ID: "e", Stars: 1, BusinessUnit: "Another guild's", BusinessUnitID: "bu-3", CreatedAt: now.Add(-time.Hour)},
+	} {
+		state.history.Add(review)
+	}
+	router := NewCommandRouter(testConfig())
+
+	s := discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", 0, discordgo.ApplicationCommandInteractionData{Name: "stats"}), state)
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "/login") {
+		t.Errorf("got %q before linking", content)
+	}
+	linkAcme(state)
+
+	respond := func(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+		s := discordtest.NewSession()
+		data := discordgo.ApplicationCommandInteractionData{Name: "stats", Options: options}
+		router.Handle(s, discordtest.Interaction("guild-1", 0, data), state)
+		return onlyResponse(t, s).Data
+	}
+	stats := func(options ...*discordgo.ApplicationCommandInteractionDataOption) string {
+		return respond(options...).Embeds[0].Description
+	}
+
+	if got := stats(); !strings.HasPrefix(got, "**3** reviews in the last 30 days, averaging **3.7★**") {
+		t.Errorf("got %q", got)
+	}
+	if got := stats(option("business_unit", discordgo.ApplicationCommandOptionString, "acme"), option("period", discordgo.ApplicationCommandOptionString, "all")); !strings.HasPrefix(got, "**3** reviews in all time") {
+		t.Errorf("got %q", got)
+	}
+	if got := stats(option("business_unit", discordgo.ApplicationCommandOptionString, "bu-2")); !strings.HasPrefix(got, "**1** review in") {
+		t.Errorf("got %q by ID", got)
+	}
+	if got := stats(option("period", discordgo.ApplicationCommandOptionString, "day")); !strings.HasPrefix(got, "**1** review in") {
+		t.Errorf("got %q", got)
+	}
+	if data := respond(option("business_unit", discordgo.ApplicationCommandOptionString, "Another guild's")); len(data.Embeds) != 0 || !strings.Contains(data.Content, "no business unit") {
+		t.Errorf("got %+v for another guild's business unit", data)
+	}
+}
+
+func TestReviewsSearchPages(t *testing.T) {
+	state := newFakeState()
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for n := range 7 {
+		state.history.Add(render.Review{ID: fmt.Sprintf("review-%d", n), Title: fmt.Sprintf("Review %d", n), Text: "Slow delivery", Stars: 1 + n%2, BusinessUnitID: "bu-1", CreatedAt: start.AddDate(0, 0, n)})
+	}
+	state.history.Add(render.Review{ID: "happy", Stars: 5, Text: "Quick delivery", BusinessUnitID: "bu-1", CreatedAt: start})
+	state.history.Add(render.Review{ID: "elsewhere", Stars: 1, Text: "Slow delivery", BusinessUnitID: "bu-3", CreatedAt: start})
+	linkAcme(state)
+	state.history.MarkReplied("review-6", start)
+	router := NewCommandRouter(testConfig())
+
+	s := discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", 0, discordgo.ApplicationCommandInteractionData{Name: "reviews", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		option("max_stars", discordgo.ApplicationCommandOptionInteger, 2.0),
+		option("keyword", discordgo.ApplicationCommandOptionString, "SLOW"),
+		option("unreplied", discordgo.ApplicationCommandOptionBoolean, true),
+		option("to", discordgo.ApplicationCommandOptionString, "2024-06-06"),
+	}}), state)
+	resp := onlyResponse(t, s)
+	embed := resp.Data.Embeds[0]
+	if embed.Description != "6 reviews found." || len(embed.Fields) != reviewsPageSize || embed.Footer.Text != "Page 1 of 2" {
+		t.Fatalf("got %q with %d fields, %q", embed.Description, len(embed.Fields), embed.Footer.Text)
+	}
+	if !strings.Contains(embed.Fields[0].Name, "Review 5") {
+		t.Errorf("newest review first, got %q", embed.Fields[0].Name)
+	}
+	buttons := resp.Data.Components[0].(discordgo.ActionsRow).Components
+	previous, next := buttons[0].(discordgo.Button), buttons[1].(discordgo.Button)
+	if !previous.Disabled || next.Disabled {
+		t.Errorf("previous disabled %t, next disabled %t", previous.Disabled, next.Disabled)
+	}
+
+	s = discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", 0, component(next.CustomID)), state)
+	resp = onlyResponse(t, s)
+	if resp.Type != discordgo.InteractionResponseUpdateMessage {
+		t.Errorf("got response type %d, want the page updated in place", resp.Type)
+	}
+	if fields := resp.Data.Embeds[0].Fields; len(fields) != 1 || !strings.Contains(fields[0].Name, "Review 0") {
+		t.Errorf("got second page %+v", fields)
+	}
+
+	s = discordtest.NewSession()
+	router.Handle(s, discordtest.Interaction("guild-1", 0, component("reviews-page:expired:1")), state)
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "expired") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestReviewsRejectsBadDates(t *testing.T) {
+	state := newFakeState()
+	linkAcme(state)
+	s := discordtest.NewSession()
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", 0, discordgo.ApplicationCommandInteractionData{Name: "reviews", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		option("from", discordgo.ApplicationCommandOptionString, "June"),
+	}}), state)
+	if content := onlyResponse(t, s).Data.Content; !strings.Contains(content, "doesn't work") {
+		t.Errorf("got %q", content)
+	}
+}
+
+func TestSLASet(t *testing.T) {
+	state := newFakeState()
+	state.AddRoutes(routing.Route{GuildID: "guild-1", ChannelID: "reviews"})
+	router := NewCommandRouter(testConfig())
+
+	sla := func(subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) string {
+		s := discordtest.NewSession()
+		options = append(options, option("channel", discordgo.ApplicationCommandOptionChannel, "reviews"))
+		router.Handle(s, discordtest.Interaction("guild-1", discordgo.PermissionManageServer, subcommandData("sla", subcommand, options...)), state)
+		return onlyResponse(t, s).Data.Content
+	}
+
+	if content := sla("set", option("reminders", discordgo.ApplicationCommandOptionString, "soon")); !strings.Contains(content, "don't work") {
+		t.Errorf("got %q", content)
+	}
+	content := sla("set",
+		option("reminders", discordgo.ApplicationCommandOptionString, "2d,24h"),
+		option("max_stars", discordgo.ApplicationCommandOptionInteger, 2.0),
+		option("escalate_to", discordgo.ApplicationCommandOptionRole, "managers"),
+	)
+	if !strings.Contains(content, "after 1d and 2d for up to 2★") || !strings.Contains(content, "<@&managers>") {
+		t.Errorf("got %q", content)
+	}
+	got := state.routes[0].ReplySLA
+	if len(got.Reminders) != 2 || got.Reminders[0] != 24*time.Hour || got.MaxStars != 2 || got.EscalateRoleIDs[0] != "managers" {
+		t.Errorf("saved %+v", got)
+	}
+
+	sla("off")
+	if !state.routes[0].ReplySLA.IsZero() {
+		t.Errorf("reminders still on: %+v", state.routes[0].ReplySLA)
+	}
+}
+
+func TestBacklogListsOverdueReviews(t *testing.T) {
+	now := time.Now()
+	state := newFakeState()
+	state.AddRoutes(routing.Route{GuildID: "guild-1", ChannelID: "reviews", BusinessUnitID: "bu-1", ReplySLA: routing.ReplySLA{Reminders: []time.Duration{4 * time.Hour}, MaxStars: 2}})
+	state.history.Add(render.Review{ID: "recent", Stars: 1, Title: "Recent", BusinessUnitID: "bu-1", CreatedAt: now.Add(-time.Hour)})
+	state.history.Add(render.Review{ID: "older", Stars: 2, Title: "Older", BusinessUnitID: "bu-1", CreatedAt: now.Add(-5 * time.Hour)})
+	state.history.Add(render.Review{ID: "oldest", Stars: 1, Title: "Oldest", BusinessUnitID: "bu-1", CreatedAt: now.Add(-50 * time.Hour)})
+	state.history.Add(render.Review{ID: "happy", Stars: 5, Title: "Happy", BusinessUnitID: "bu-1", CreatedAt: now.Add(-50 * time.Hour)})
+	state.history.Add(render.Review{ID: "replied", Stars: 1, Title: "Replied", BusinessUnitID: "bu-1", CreatedAt: now.Add(-50 * time.Hour)})
+	state.history.Add(render.Review{ID: "elsewhere", Stars: 1, Title: "Another guild's", BusinessUnitID: "bu-3", CreatedAt: now.Add(-50 * time.Hour)})
+	state.history.MarkReplied("replied", now)
+	linkAcme(state)
+
+	s := discordtest.NewSession()
+	NewCommandRouter(testConfig()).Handle(s, discordtest.Interaction("guild-1", 0, discordgo.ApplicationCommandInteractionData{Name: "backlog"}), state)
+	embed := onlyResponse(t, s).Data.Embeds[0]
+	lines := strings.Split(embed.Description, "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "`2d 2h` ★☆☆☆☆ Oldest") || !strings.Contains(lines[1], "Older") {
+		t.Errorf("got backlog %q", embed.Description)
+	}
+	if embed.Footer.Text != "2 reviews overdue" {
+		t.Errorf("got footer %q", embed.Footer.Text)
+	}
+}
+
+func TestBacklogWithoutRoutesKeepsToTheGuild(t *testing.T) {
+	now := time.Now()
+	state := newFakeState()
+	state.history.Add(render.Review{ID: "ours", Stars: 4, Title: "Ours", BusinessUnitID: "bu-2", CreatedAt: now.Add(-50 * time.Hour)})
+	state.history.Add(render.Review{ID: "elsewhere", Stars: 1, Title: "Another guild's", BusinessUnitID: "bu-3", CreatedAt: now.Add(-50 * time.Hour)})
+	router := NewCommandRouter(testConfig())
+
+	backlog := func() *discordgo.InteractionResponse {
+		s := discordtest.NewSession()
+		router.Handle(s, discordtest.Interaction("guild-1", 0, discordgo.ApplicationCommandInteractionData{Name: "backlog"}), state)
+		return onlyResponse(t, s)
+	}
+
+	if content := backlog().Data.Content; !strings.Contains(content, "/login") {
+		t.Errorf("got %q before linking", content)
+	}
+	linkAcme(state)
+	embeds := backlog().Data.Embeds
+	if len(embeds) != 1 || strings.Contains(embeds[0].Description, "Another guild's") || !strings.Contains(embeds[0].Description, "Ours") {
+		t.Errorf("got backlog %+v", embeds)
+	}
+}
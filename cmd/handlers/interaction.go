@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// InteractionUser returns the user behind an interaction. Discord sets
+// Member when the interaction comes from a guild and User when it comes
+// from a DM, so callers shouldn't reach into either directly.
+func InteractionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return i.User
+	}
+	return &discordgo.User{}
+}
+
+// interactionLogger returns a logger that tags everything with the
+// interaction, guild and user it was logged for.
+func interactionLogger(i *discordgo.InteractionCreate) *slog.Logger {
+	return slog.With("interaction_id", i.ID, "guild_id", i.GuildID, "user_id", InteractionUser(i).ID)
+}
+
+func isDM(i *discordgo.InteractionCreate) bool {
+	return i.GuildID == "" || i.Member == nil
+}
+
+func respondEphemeral(s Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			// Replies name roles and members without pinging them
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err == nil {
+		return
+	}
+
+	// The handler may already have responded before failing, in which case
+	// only a follow-up message will reach the user
+	_, followupErr := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content:         content,
+		Flags:           discordgo.MessageFlagsEphemeral,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if followupErr != nil {
+		interactionLogger(i).Error("cannot respond to interaction", "error", err, "followup_error", followupErr)
+	}
+}
+
+// GuildOnly refuses interactions that come from a DM.
+func GuildOnly(next InteractionHandler) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		if isDM(i) {
+			respondEphemeral(s, i, "This command can only be used in a server.")
+			return
+		}
+		next(s, i, state)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+)
+
+func loginCommand(cfg *config.Config) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		// respond with a button to open a website
+		baseUrl := strings.TrimSuffix(cfg.AuthURL, "/") + "/?redirect_uri="
+		redirectUrl := cfg.RedirectURL()
+		clientId := cfg.ClientID
+		queryParams := fmt.Sprintf("&client_id=%s&response_type=token", clientId)
+		// Trustpilot hands state back with the token, which is how the token finds its way to this guild
+		stateQueryParams := fmt.Sprintf("&state=%s", state.CreateLoginState(i.GuildID))
+		fullUrl := baseUrl + url.QueryEscape(redirectUrl) + queryParams + stateQueryParams
+
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Login to the bot",
+				Flags:   discordgo.MessageFlagsEphemeral,
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.Button{
+								Label: "Login",
+								Style: discordgo.LinkButton,
+								URL:   fullUrl,
+							},
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			interactionLogger(i).Error("cannot respond to login command", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
+
+// maxMentionRules keeps a route's pings down to something people can follow
+const maxMentionRules = 10
+
+var minRule = 1.0
+
+// mentionsOptions are the /mentions subcommands.
+func mentionsOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "add",
+			Description: "Ping a role or member about the reviews that match",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to ping in"),
+				{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "Role to ping"},
+				{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "Member to ping"},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "min_stars", Description: "Lowest rating to ping for", MinValue: &minStars, MaxValue: 5},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "max_stars", Description: "Highest rating to ping for", MinValue: &minStars, MaxValue: 5},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "include", Description: "Comma separated keywords, one of which must be mentioned"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "languages", Description: "Comma separated language codes, like en,de"},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "List who is pinged about reviews in each channel",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "remove",
+			Description: "Stop a mention rule pinging",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel the rule is in"),
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "rule", Description: "Rule number, as shown by /mentions list", Required: true, MinValue: &minRule, MaxValue: maxMentionRules},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "quiet",
+			Description: "Post reviews without pinging during these hours, leave both times empty to turn off",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to keep quiet"),
+				{Type: discordgo.ApplicationCommandOptionString, Name: "start", Description: "When pings stop, like 22:00"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "end", Description: "When pings start again, like 07:30"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "timezone", Description: "Timezone of the times, like Europe/London, UTC if empty"},
+			},
+		},
+	}
+}
+
+func mentionsCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) != 1 {
+		respondEphemeral(s, i, "Pick one of add, list, remove or quiet.")
+		return
+	}
+	subcommand := data.Options[0]
+	options := commandOptions(subcommand.Options)
+
+	switch subcommand.Name {
+	case "add":
+		addMentionRule(s, i, state, options)
+	case "list":
+		listMentionRules(s, i, state)
+	case "remove":
+		removeMentionRule(s, i, state, options)
+	case "quiet":
+		setQuietHours(s, i, state, options)
+	default:
+		respondEphemeral(s, i, "Unknown mentions command")
+	}
+}
+
+func addMentionRule(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	route, ok := guildRoute(state, i.GuildID, channelID)
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+	if len(route.MentionRules) >= maxMentionRules {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> already has %d mention rules, remove one first.", channelID, maxMentionRules))
+		return
+	}
+
+	var rule routing.MentionRule
+	if option, ok := options["role"]; ok {
+		rule.RoleIDs = []string{idOption(option)}
+	}
+	if option, ok := options["user"]; ok {
+		rule.UserIDs = []string{idOption(option)}
+	}
+	if len(rule.RoleIDs) == 0 && len(rule.UserIDs) == 0 {
+		respondEphemeral(s, i, "Pick a role or member to ping.")
+		return
+	}
+	if option, ok := options["min_stars"]; ok {
+		rule.Filter.MinStars = int(option.IntValue())
+	}
+	if option, ok := options["max_stars"]; ok {
+		rule.Filter.MaxStars = int(option.IntValue())
+	}
+	if option, ok := options["include"]; ok {
+		rule.Filter.Include = routing.ParseList(option.StringValue())
+	}
+	if option, ok := options["languages"]; ok {
+		rule.Filter.Languages = routing.ParseList(option.StringValue())
+	}
+	if err := rule.Filter.Validate(); err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("That rule can't match anything: %s.", err))
+		return
+	}
+
+	state.AddMentionRule(i.GuildID, channelID, rule)
+	respondEphemeral(s, i, fmt.Sprintf("<#%s> will ping %s.", channelID, rule))
+}
+
+func listMentionRules(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	var lines []string
+	for _, route := range state.GetGuildRoutes(i.GuildID) {
+		if len(route.MentionRules) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("<#%s>, quiet hours %s:", route.ChannelID, route.QuietHours))
+		for n, rule := range route.MentionRules {
+			lines = append(lines, fmt.Sprintf("%d. %s", n+1, rule))
+		}
+	}
+	if len(lines) == 0 {
+		respondEphemeral(s, i, "Nobody is pinged about reviews, add someone with `/mentions add`.")
+		return
+	}
+	respondEphemeral(s, i, render.Truncate(strings.Join(lines, "\n"), render.MaxContent))
+}
+
+func removeMentionRule(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	number := int(options["rule"].IntValue())
+	if !state.RemoveMentionRule(i.GuildID, channelID, number-1) {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> has no mention rule %d.", channelID, number))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("Removed mention rule %d from <#%s>.", number, channelID))
+}
+
+func setQuietHours(s Session, i *discordgo.InteractionCreate, state SharedState, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	channelID := idOption(options["channel"])
+	var start, end, timezone string
+	if option, ok := options["start"]; ok {
+		start = option.StringValue()
+	}
+	if option, ok := options["end"]; ok {
+		end = option.StringValue()
+	}
+	if option, ok := options["timezone"]; ok {
+		timezone = option.StringValue()
+	}
+
+	var quiet routing.QuietHours
+	if start != "" || end != "" {
+		var err error
+		if quiet, err = routing.ParseQuietHours(start, end, timezone); err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("Those quiet hours don't work: %s.", err))
+			return
+		}
+	}
+	if !state.SetQuietHours(i.GuildID, channelID, quiet) {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+
+	if quiet.IsZero() {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> will ping at any time.", channelID))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("<#%s> will post reviews without pinging from %s.", channelID, quiet))
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/metrics"
+)
+
+// InteractionHandler handles a single interaction event.
+type InteractionHandler func(s Session, i *discordgo.InteractionCreate, state SharedState)
+
+// InteractionMiddleware wraps an InteractionHandler with extra behaviour.
+type InteractionMiddleware func(next InteractionHandler) InteractionHandler
+
+// Chain wraps h in the given middlewares. The first middleware is the
+// outermost, so it sees the interaction first and the result last.
+func Chain(h InteractionHandler, middlewares ...InteractionMiddleware) InteractionHandler {
+	for n := len(middlewares) - 1; n >= 0; n-- {
+		h = middlewares[n](h)
+	}
+	return h
+}
+
+// interactionName returns the command name or custom ID an interaction is for.
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return i.ModalSubmitData().CustomID
+	}
+	return i.Type.String()
+}
+
+// Recover stops a panicking handler from taking the bot down. It logs the
+// stack trace along with the interaction it was handling and lets the user
+// know something went wrong. Metrics, inside it, counts the failure.
+func Recover(next InteractionHandler) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			name := interactionName(i)
+			interactionLogger(i).Error("recovered from panic handling interaction",
+				"type", i.Type.String(), "name", name, "channel_id", i.ChannelID, "panic", r, "stack", string(debug.Stack()))
+			respondEphemeral(s, i, "Something went wrong while handling that, please try again.")
+		}()
+
+		next(s, i, state)
+	}
+}
+
+// Metrics counts every interaction by guild, name and whether it completed
+// or panicked. It belongs inside Recover so it sees the panic first.
+func Metrics(next InteractionHandler) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		// Only the route name, custom ID params like review IDs would be unbounded
+		name, _ := ParseCustomID(interactionName(i))
+		defer func() {
+			if r := recover(); r != nil {
+				metrics.Interactions.WithLabelValues(i.GuildID, name, "panic").Inc()
+				panic(r)
+			}
+		}()
+
+		next(s, i, state)
+		metrics.Interactions.WithLabelValues(i.GuildID, name, "ok").Inc()
+	}
+}
+
+// RecoverEvent wraps a gateway event handler so a panic in it is logged and
+// counted under name instead of crashing the bot.
+func RecoverEvent[E any](name string, h func(s *discordgo.Session, e E)) func(s *discordgo.Session, e E) {
+	return func(s *discordgo.Session, e E) {
+		defer func() {
+			if r := recover(); r != nil {
+				metrics.EventPanics.WithLabelValues(name).Inc()
+				slog.Error("recovered from panic handling event", "event", name, "panic", r, "stack", string(debug.Stack()))
+			}
+		}()
+
+		h(s, e)
+	}
+}
@@ -1,38 +1,39 @@
 package handlers
 
 import (
-	"fmt"
-
 	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
 )
 
-func ModalCreate(s *discordgo.Session, m *discordgo.InteractionCreate) {
-	fmt.Println("New Event: Message: ")
-	fmt.Println(m.Interaction.ChannelID)
-
-	s.InteractionRespond(m.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseModal,
-		Data: &discordgo.InteractionResponseData{
-			Title:    "Modal Title",
-			CustomID: "modal-1",
-			Components: []discordgo.MessageComponent{
-				discordgo.StringSelectMenu: &discordgo.SelectMenu{
-					CustomID:    "select-1",
-					Placeholder: "Select an option",
-					Options: []discordgo.SelectMenuOption{
-						{
-							Label:       "Option 1",
-							Value:       "option-1",
-							Description: "This is option 1",
-						},
-						{
-							Label:       "Option 2",
-							Value:       "option-2",
-							Description: "This is option 2",
-						},
-					},
-				},
-			},
+// modals are the modal forms the bot handles, keyed by custom ID.
+func modals(cfg *config.Config) []*Component {
+	return []*Component{
+		{
+			// reply-modal:<reviewID> is opened by the reply button
+			CustomID:  "reply-modal",
+			Protected: true,
+			Handler:   replyModalSubmit(cfg),
+		},
+		{
+			CustomID:  "template-modal",
+			Protected: true,
+			Handler:   templateModalSubmit,
 		},
-	})
+	}
+}
+
+// modalValue returns the value of the text input with customID in a modal submit.
+func modalValue(i *discordgo.InteractionCreate, customID string) string {
+	for _, row := range i.ModalSubmitData().Components {
+		actionsRow, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actionsRow.Components {
+			if input, ok := component.(*discordgo.TextInput); ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
 }
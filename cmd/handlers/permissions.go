@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultCommandPermissions is what a member needs to run configuration
+// commands when the guild has not configured any roles of its own.
+const DefaultCommandPermissions int64 = discordgo.PermissionManageServer
+
+// hasManageServer reports whether the invoking member has Manage Server,
+// either directly or through Administrator.
+func hasManageServer(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	perms := i.Member.Permissions
+	return perms&discordgo.PermissionAdministrator != 0 || perms&DefaultCommandPermissions != 0
+}
+
+// isAuthorised reports whether the invoking member may run configuration
+// commands in this guild: Manage Server always works, and members holding
+// one of the guild's configured roles are allowed as well.
+func isAuthorised(i *discordgo.InteractionCreate, state SharedState) bool {
+	if hasManageServer(i) {
+		return true
+	}
+	if i.Member == nil {
+		return false
+	}
+
+	allowed := state.GetAllowedRoles(i.GuildID)
+	for _, memberRole := range i.Member.Roles {
+		for _, role := range allowed {
+			if memberRole == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequireAuthorised refuses interactions from members that may not run
+// configuration commands.
+func RequireAuthorised(next InteractionHandler) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		if !isAuthorised(i, state) {
+			respondForbidden(s, i)
+			return
+		}
+		next(s, i, state)
+	}
+}
+
+// RequireManageServer refuses interactions from members without Manage
+// Server, regardless of the guild's configured roles.
+func RequireManageServer(next InteractionHandler) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		if !hasManageServer(i) {
+			respondForbidden(s, i)
+			return
+		}
+		next(s, i, state)
+	}
+}
+
+func respondForbidden(s Session, i *discordgo.InteractionCreate) {
+	respondEphemeral(s, i, "You need the Manage Server permission or one of this server's configured roles to do that.")
+}
+
+func createRoleSelect(i *discordgo.InteractionCreate, state SharedState) *discordgo.InteractionResponseData {
+	minValues := 0
+	current := state.GetAllowedRoles(i.GuildID)
+	defaults := make([]discordgo.SelectMenuDefaultValue, len(current))
+	for n, role := range current {
+		defaults[n] = discordgo.SelectMenuDefaultValue{ID: role, Type: discordgo.SelectMenuDefaultValueRole}
+	}
+
+	return &discordgo.InteractionResponseData{
+		Content: "Choose the roles that may change the bot's settings. Members with Manage Server can always do so.",
+		Flags:   discordgo.MessageFlagsEphemeral,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						CustomID:      "permissions-role-select",
+						Placeholder:   "Select roles",
+						MenuType:      discordgo.RoleSelectMenu,
+						MinValues:     &minValues,
+						MaxValues:     25,
+						DefaultValues: defaults,
+					},
+				},
+			},
+		},
+	}
+}
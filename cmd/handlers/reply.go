@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/server/handlers/utils"
+)
+
+func replyButton(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+	if len(params) != 1 {
+		respondEphemeral(s, i, "This button doesn't belong to a review.")
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			Title:    "Reply to review",
+			CustomID: CustomID("reply-modal", params[0]),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "message",
+							Label:     "Reply",
+							Style:     discordgo.TextInputParagraph,
+							Required:  true,
+							MaxLength: 4000,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot open reply modal", "error", err)
+	}
+}
+
+func replyModalSubmit(cfg *config.Config) ComponentHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+		if len(params) != 1 {
+			respondEphemeral(s, i, "This form doesn't belong to a review.")
+			return
+		}
+		reviewID := params[0]
+		logger := interactionLogger(i).With("review_id", reviewID)
+
+		link, ok := state.GetTrustpilotLink(i.GuildID)
+		if !ok {
+			respondEphemeral(s, i, "This server isn't linked to Trustpilot yet, use /login first.")
+			return
+		}
+
+		// Trustpilot can take longer to answer than Discord waits for a response
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+		if err != nil {
+			logger.Error("cannot defer reply modal response", "error", err)
+			return
+		}
+
+		content := "Reply sent to Trustpilot."
+		err = utils.SendReviewReply(cfg.APIURL, reviewID, link.BusinessUserID, modalValue(i, "message"), link.AccessToken)
+		if err != nil {
+			logger.Error("cannot reply to review", "error", err)
+			content = "Trustpilot didn't accept the reply, please try again."
+		} else {
+			logger.Info("replied to review")
+		}
+
+		_, followupErr := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if followupErr != nil {
+			logger.Error("cannot send reply modal follow-up", "error", followupErr)
+		}
+		if err == nil {
+			state.MarkReviewReplied(reviewID)
+			for _, edit := range delivery.ResolveThreads(state, reviewID) {
+				if err := delivery.EditThread(s, edit); err != nil {
+					logger.Error("cannot resolve review thread", "thread_id", edit.ChannelID, "error", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// reviewsPageSize is how many reviews each page of /reviews shows
+const reviewsPageSize = 5
+
+// dateLayout is how /reviews takes dates
+const dateLayout = "2006-01-02"
+
+// reviewsOptions are the /reviews options.
+func reviewsOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionInteger, Name: "min_stars", Description: "Lowest rating to show", MinValue: &minStars, MaxValue: 5},
+		{Type: discordgo.ApplicationCommandOptionInteger, Name: "max_stars", Description: "Highest rating to show", MinValue: &minStars, MaxValue: 5},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "from", Description: "First day to show reviews from, like 2024-06-01"},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "to", Description: "Last day to show reviews from, like 2024-06-30"},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "keyword", Description: "Word or phrase the title or text must contain"},
+		{Type: discordgo.ApplicationCommandOptionBoolean, Name: "unreplied", Description: "Only show reviews nobody has replied to"},
+		businessUnitOption("Business unit name or ID, all of them if empty"),
+	}
+}
+
+func reviewsCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	businessUnitIDs := guildBusinessUnitIDs(state, i.GuildID)
+	if len(businessUnitIDs) == 0 {
+		respondEphemeral(s, i, "This server isn't linked to Trustpilot yet, use /login first.")
+		return
+	}
+	q, err := reviewsQuery(commandOptions(i.ApplicationCommandData().Options))
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("That search doesn't work: %s.", err))
+		return
+	}
+	link, _ := state.GetTrustpilotLink(i.GuildID)
+	unit, wanted, ok := chosenBusinessUnit(i, link)
+	if !ok {
+		respondUnknownBusinessUnit(s, i, wanted)
+		return
+	}
+	if unit.ID != "" {
+		businessUnitIDs = []string{unit.ID}
+	}
+	// The saved search keeps to them as its pages are turned too
+	q.BusinessUnitIDs = businessUnitIDs
+
+	searchID := state.SaveSearch(q)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: reviewsPage(state.SearchReviews(q), searchID, 0),
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to reviews command", "error", err)
+	}
+}
+
+// reviewsQuery builds the search /reviews was asked for.
+func reviewsQuery(options map[string]*discordgo.ApplicationCommandInteractionDataOption) (history.Query, error) {
+	var q history.Query
+	if option, ok := options["min_stars"]; ok {
+		q.MinStars = int(option.IntValue())
+	}
+	if option, ok := options["max_stars"]; ok {
+		q.MaxStars = int(option.IntValue())
+	}
+	if q.MinStars > 0 && q.MaxStars > 0 && q.MinStars > q.MaxStars {
+		return history.Query{}, fmt.Errorf("min_stars is above max_stars")
+	}
+	if option, ok := options["from"]; ok {
+		from, err := time.Parse(dateLayout, strings.TrimSpace(option.StringValue()))
+		if err != nil {
+			return history.Query{}, fmt.Errorf("from should be a date like 2024-06-01")
+		}
+		q.Since = from
+	}
+	if option, ok := options["to"]; ok {
+		to, err := time.Parse(dateLayout, strings.TrimSpace(option.StringValue()))
+		if err != nil {
+			return history.Query{}, fmt.Errorf("to should be a date like 2024-06-30")
+		}
+		// The whole of the last day is included
+		q.Until = to.AddDate(0, 0, 1)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return history.Query{}, fmt.Errorf("from is after to")
+	}
+	if option, ok := options["keyword"]; ok {
+		q.Keyword = strings.TrimSpace(option.StringValue())
+	}
+	if option, ok := options["unreplied"]; ok {
+		q.Unreplied = option.BoolValue()
+	}
+	return q, nil
+}
+
+// reviewsPageButton turns to another page of a saved /reviews search.
+func reviewsPageButton(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+	if len(params) != 2 {
+		respondEphemeral(s, i, "This button doesn't belong to a search.")
+		return
+	}
+	page, err := strconv.Atoi(params[1])
+	if err != nil {
+		respondEphemeral(s, i, "This button doesn't belong to a search.")
+		return
+	}
+	q, ok := state.GetSearch(params[0])
+	if !ok {
+		respondEphemeral(s, i, "This search has expired, run /reviews again.")
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: reviewsPage(state.SearchReviews(q), params[0], page),
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot turn reviews page", "error", err)
+	}
+}
+
+// reviewsPage shows page of records, with buttons to the pages either side.
+func reviewsPage(records []history.Record, searchID string, page int) *discordgo.InteractionResponseData {
+	pages := max((len(records)+reviewsPageSize-1)/reviewsPageSize, 1)
+	page = min(max(page, 0), pages-1)
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Reviews",
+		Description: fmt.Sprintf("%d %s found.", len(records), render.Plural(len(records), "review", "reviews")),
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d", page+1, pages)},
+	}
+	if len(records) == 0 {
+		embed.Description = "No reviews match that search."
+	}
+	for _, record := range records[page*reviewsPageSize : min((page+1)*reviewsPageSize, len(records))] {
+		embed.Fields = append(embed.Fields, reviewField(record))
+	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds:          []*discordgo.MessageEmbed{embed},
+		Flags:           discordgo.MessageFlagsEphemeral,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Previous",
+						Style:    discordgo.SecondaryButton,
+						CustomID: CustomID("reviews-page", searchID, strconv.Itoa(page-1)),
+						Disabled: page == 0,
+					},
+					discordgo.Button{
+						Label:    "Next",
+						Style:    discordgo.SecondaryButton,
+						CustomID: CustomID("reviews-page", searchID, strconv.Itoa(page+1)),
+						Disabled: page == pages-1,
+					},
+				},
+			},
+		},
+	}
+}
+
+// reviewField is a review's entry on a page of /reviews.
+func reviewField(record history.Record) *discordgo.MessageEmbedField {
+	title := "Untitled review"
+	if record.Title != "" {
+		title = render.Escape(record.Title)
+	}
+
+	var details []string
+	if record.ConsumerName != "" {
+		details = append(details, "by "+render.Escape(record.ConsumerName))
+	}
+	if record.BusinessUnit != "" {
+		details = append(details, render.Escape(record.BusinessUnit))
+	}
+	details = append(details, fmt.Sprintf("<t:%d:d>", record.CreatedAt.Unix()))
+	if record.Replied() {
+		details = append(details, "replied")
+	} else {
+		details = append(details, "**unreplied**")
+	}
+	if record.URL != "" {
+		details = append(details, "[view]("+record.URL+")")
+	}
+
+	value := strings.Join(details, " · ")
+	if record.Text != "" {
+		value = render.Escape(render.Truncate(record.Text, 200)) + "\n" + value
+	}
+	return &discordgo.MessageEmbedField{
+		Name:  render.Truncate(record.StarBar()+" "+title, render.MaxFieldName),
+		Value: render.Truncate(value, render.MaxFieldValue),
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ComponentHandler handles a message component or modal submit. params holds
+// whatever followed the route name in the custom ID, so "reply:abc" routed
+// to "reply" is called with ["abc"].
+type ComponentHandler func(s Session, i *discordgo.InteractionCreate, state SharedState, params []string)
+
+// Command declares a slash command once; both its registration with Discord
+// and its dispatch are driven from this declaration.
+type Command struct {
+	Name        string
+	Description string
+	Options     []*discordgo.ApplicationCommandOption
+	// Permissions is the default member permission Discord checks before
+	// showing the command, nil lets everyone see it
+	Permissions *int64
+	// GuildOnly commands are hidden from and refused in DMs
+	GuildOnly bool
+	// Protected commands are limited to Manage Server and the guild's configured roles
+	Protected   bool
+	Handler     InteractionHandler
+	Middlewares []InteractionMiddleware
+}
+
+// Component declares a message component or modal route. CustomID is
+// matched against everything before the first ':' of the incoming custom ID.
+type Component struct {
+	CustomID    string
+	GuildOnly   bool
+	Protected   bool
+	Handler     ComponentHandler
+	Middlewares []InteractionMiddleware
+}
+
+// Router dispatches interactions to the commands and components declared on it.
+type Router struct {
+	commands    []*Command
+	byName      map[string]*Command
+	components  map[string]*Component
+	modals      map[string]*Component
+	middlewares []InteractionMiddleware
+}
+
+// NewRouter returns an empty router. The middlewares wrap every interaction
+// it handles, including ones for unknown commands.
+func NewRouter(middlewares ...InteractionMiddleware) *Router {
+	return &Router{
+		byName:      map[string]*Command{},
+		components:  map[string]*Component{},
+		modals:      map[string]*Component{},
+		middlewares: middlewares,
+	}
+}
+
+func (r *Router) AddCommand(commands ...*Command) {
+	for _, c := range commands {
+		r.commands = append(r.commands, c)
+		r.byName[c.Name] = c
+	}
+}
+
+func (r *Router) AddComponent(components ...*Component) {
+	for _, c := range components {
+		r.components[c.CustomID] = c
+	}
+}
+
+func (r *Router) AddModal(modals ...*Component) {
+	for _, c := range modals {
+		r.modals[c.CustomID] = c
+	}
+}
+
+// ApplicationCommands returns the Discord definitions of every declared
+// command, in the order they were added.
+func (r *Router) ApplicationCommands() []*discordgo.ApplicationCommand {
+	result := make([]*discordgo.ApplicationCommand, len(r.commands))
+	for n, c := range r.commands {
+		result[n] = c.ApplicationCommand()
+	}
+	return result
+}
+
+// ApplicationCommand returns the definition Discord needs to register c.
+func (c *Command) ApplicationCommand() *discordgo.ApplicationCommand {
+	cmd := &discordgo.ApplicationCommand{
+		Name:                     c.Name,
+		Description:              c.Description,
+		Type:                     discordgo.ChatApplicationCommand,
+		Options:                  c.Options,
+		DefaultMemberPermissions: c.Permissions,
+	}
+	if c.GuildOnly {
+		dmPermission := false
+		cmd.DMPermission = &dmPermission
+	}
+	return cmd
+}
+
+// Handle dispatches an interaction to the command or component it is for.
+func (r *Router) Handle(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	var h InteractionHandler
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		interactionLogger(i).Info("command", "name", i.ApplicationCommandData().Name)
+		h = r.commandHandler(i.ApplicationCommandData().Name)
+	case discordgo.InteractionMessageComponent:
+		interactionLogger(i).Info("component", "custom_id", i.MessageComponentData().CustomID, "values", i.MessageComponentData().Values)
+		h = componentHandler(r.components, i.MessageComponentData().CustomID, "Unknown select option")
+	case discordgo.InteractionModalSubmit:
+		interactionLogger(i).Info("modal", "custom_id", i.ModalSubmitData().CustomID)
+		h = componentHandler(r.modals, i.ModalSubmitData().CustomID, "Unknown form")
+	default:
+		return
+	}
+
+	Chain(h, r.middlewares...)(s, i, state)
+}
+
+func (r *Router) commandHandler(name string) InteractionHandler {
+	c, ok := r.byName[name]
+	if !ok {
+		return unknownHandler("Unknown Command")
+	}
+	return Chain(c.Handler, guards(c.GuildOnly, c.Protected, c.Middlewares)...)
+}
+
+func componentHandler(routes map[string]*Component, customID string, unknown string) InteractionHandler {
+	name, params := ParseCustomID(customID)
+	c, ok := routes[name]
+	if !ok {
+		return unknownHandler(unknown)
+	}
+
+	h := func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		c.Handler(s, i, state, params)
+	}
+	return Chain(h, guards(c.GuildOnly, c.Protected, c.Middlewares)...)
+}
+
+// guards puts the access checks a route asked for in front of its own middlewares.
+func guards(guildOnly bool, protected bool, middlewares []InteractionMiddleware) []InteractionMiddleware {
+	var result []InteractionMiddleware
+	if guildOnly || protected {
+		result = append(result, GuildOnly)
+	}
+	if protected {
+		result = append(result, RequireAuthorised)
+	}
+	return append(result, middlewares...)
+}
+
+func unknownHandler(content string) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		respondEphemeral(s, i, content)
+	}
+}
+
+// CustomID builds a component custom ID that routes to name with params.
+func CustomID(name string, params ...string) string {
+	return strings.Join(append([]string{name}, params...), ":")
+}
+
+// ParseCustomID splits a custom ID built by CustomID back into its route
+// name and params.
+func ParseCustomID(customID string) (string, []string) {
+	parts := strings.Split(customID, ":")
+	return parts[0], parts[1:]
+}
@@ -2,53 +2,140 @@ package handlers
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/forum"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
 )
 
-// Define interface for the shared state
-type SharedState interface {
-	AppendToStateArr(values ...string)
-	AppendToChannelIDs(values ...string)
-	GetBuids() []string
+// components are the message components the bot handles, keyed by custom ID.
+func components(cfg *config.Config) []*Component {
+	return []*Component{
+		{
+			CustomID:  "bu-select",
+			Protected: true,
+			Handler:   businessUnitSelect,
+		},
+		{
+			// channel-select:<businessUnitID> adds routes for the business unit picked
+			CustomID:  "channel-select",
+			Protected: true,
+			Handler:   channelSelect,
+		},
+		{
+			CustomID:    "permissions-role-select",
+			GuildOnly:   true,
+			Middlewares: []InteractionMiddleware{RequireManageServer},
+			Handler: func(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+				state.SetAllowedRoles(i.GuildID, i.MessageComponentData().Values...)
+
+				content := "Only members with Manage Server can change the settings now."
+				if len(i.MessageComponentData().Values) > 0 {
+					content = fmt.Sprintf("Members with Manage Server or any of %d selected roles can change the settings now.", len(i.MessageComponentData().Values))
+				}
+				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Flags:   discordgo.MessageFlagsEphemeral,
+						Content: content,
+					},
+				})
+			},
+		},
+		{
+			// reply:<reviewID> is attached to every review posted by the webhook
+			CustomID:  "reply",
+			Protected: true,
+			Handler:   replyButton,
+		},
+		{
+			// reviews-page:<searchID>:<page> turns the pages of /reviews
+			CustomID:  "reviews-page",
+			GuildOnly: true,
+			Handler:   reviewsPageButton,
+		},
+	}
+}
+
+// linkedBusinessUnit returns the business unit of guildID's Trustpilot
+// account with businessUnitID.
+func linkedBusinessUnit(state SharedState, guildID string, businessUnitID string) (types.LinkedBusinessUnit, bool) {
+	link, _ := state.GetTrustpilotLink(guildID)
+	for _, unit := range link.BusinessUnits {
+		if unit.ID == businessUnitID {
+			return unit, true
+		}
+	}
+	return types.LinkedBusinessUnit{}, false
 }
 
-var selectHandlersMap = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState){
-	"select-1": func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-		state.AppendToStateArr(i.MessageComponentData().Values...)
-		fmt.Println("Selected values:", i.MessageComponentData().Values)
+// businessUnitSelect shows the settings again with the picked business unit,
+// so the channels picked next get its reviews.
+func businessUnitSelect(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+	values := i.MessageComponentData().Values
+	if len(values) != 1 {
+		respondEphemeral(s, i, "Pick one business unit.")
+		return
+	}
+	if _, ok := linkedBusinessUnit(state, i.GuildID, values[0]); !ok {
+		respondEphemeral(s, i, "That business unit isn't linked to this server, use /login first.")
+		return
+	}
 
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: fmt.Sprintf("You selected option 1 from %s", i.MessageComponentData().Values),
-			},
-		})
-	},
-	"channel-select": func(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-		state.AppendToChannelIDs(i.MessageComponentData().Values...)
-		fmt.Println("Selected values:", i.MessageComponentData().Values)
-
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Flags:   discordgo.MessageFlagsEphemeral,
-				Content: fmt.Sprintf("You selected option 2 from %s", i.MessageComponentData().CustomID),
-			},
-		})
-	},
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: createDropdowns(i, state, values[0]),
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to business unit select", "error", err)
+	}
 }
 
-func SelectHandler(s *discordgo.Session, i *discordgo.InteractionCreate, state SharedState) {
-	if handler, ok := selectHandlersMap[i.MessageComponentData().CustomID]; ok {
-		handler(s, i, state)
-	} else {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Unknown select option",
-			},
-		})
+func channelSelect(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+	if len(params) != 1 {
+		respondEphemeral(s, i, "Pick a business unit first.")
+		return
+	}
+	unit, ok := linkedBusinessUnit(state, i.GuildID, params[0])
+	if !ok {
+		respondEphemeral(s, i, "That business unit isn't linked to this server, use /login first.")
+		return
+	}
+
+	data := i.MessageComponentData()
+	content := fmt.Sprintf("Reviews of %s will be posted in %s.", render.Escape(unit.Name), channelMentions(data.Values))
+
+	routes := make([]routing.Route, len(data.Values))
+	for n, channelID := range data.Values {
+		routes[n] = routing.Route{GuildID: i.GuildID, ChannelID: channelID, BusinessUnitID: unit.ID}
+		if channel, ok := data.Resolved.Channels[channelID]; ok && channel.Type == discordgo.ChannelTypeGuildForum {
+			routes[n].Forum = true
+			if err := setupForum(s, channelID); err != nil {
+				interactionLogger(i).Warn("cannot add review tags to forum", "channel_id", channelID, "error", err)
+				content += fmt.Sprintf("\nI couldn't add review tags to <#%s>, give me Manage Channels or add tags named %s yourself.", channelID, strings.Join(forum.BotTags(), ", "))
+			}
+		}
+	}
+	state.AddRoutes(routes...)
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: content,
+		},
+	})
+}
+
+// channelMentions lists channelIDs as channel mentions.
+func channelMentions(channelIDs []string) string {
+	mentions := make([]string, len(channelIDs))
+	for n, channelID := range channelIDs {
+		mentions[n] = "<#" + channelID + ">"
 	}
+	return strings.Join(mentions, ", ")
 }
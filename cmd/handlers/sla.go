@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
+
+// defaultBacklogAge is how long a review waits before /backlog counts it
+// as overdue, in channels without reminders
+const defaultBacklogAge = 24 * time.Hour
+
+// maxBacklogLines is how many overdue reviews /backlog lists
+const maxBacklogLines = 20
+
+// slaOptions are the /sla subcommands.
+func slaOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "set",
+			Description: "Remind a channel about reviews nobody has replied to",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to remind"),
+				{Type: discordgo.ApplicationCommandOptionString, Name: "reminders", Description: "How long after a review to remind, like 24h,2d", Required: true},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "max_stars", Description: "Highest rating to remind about, all if empty", MinValue: &minStars, MaxValue: 5},
+				{Type: discordgo.ApplicationCommandOptionRole, Name: "escalate_to", Description: "Role to ping from the second reminder on"},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "off",
+			Description: "Stop reminding a channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				filterChannelOption("Review channel to stop reminding"),
+			},
+		},
+	}
+}
+
+// backlogOptions are the /backlog options.
+func backlogOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionChannel,
+			Name:         "channel",
+			Description:  "Only reviews for this channel, by its reminders",
+			ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildForum},
+		},
+	}
+}
+
+func slaCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) != 1 {
+		respondEphemeral(s, i, "Pick one of set or off.")
+		return
+	}
+	subcommand := data.Options[0]
+	options := commandOptions(subcommand.Options)
+	channelID := idOption(options["channel"])
+
+	switch subcommand.Name {
+	case "set":
+		reminders, err := routing.ParseReminders(options["reminders"].StringValue())
+		if err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("Those reminders don't work: %s.", err))
+			return
+		}
+		sla := routing.ReplySLA{Reminders: reminders}
+		if option, ok := options["max_stars"]; ok {
+			sla.MaxStars = int(option.IntValue())
+		}
+		if option, ok := options["escalate_to"]; ok {
+			sla.EscalateRoleIDs = []string{idOption(option)}
+		}
+		if !state.SetRouteReplySLA(i.GuildID, channelID, sla) {
+			respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+			return
+		}
+
+		content := fmt.Sprintf("<#%s> will be reminded about reviews without a reply %s.", channelID, sla)
+		if len(sla.EscalateRoleIDs) > 0 && len(reminders) > 1 {
+			content += fmt.Sprintf(" <@&%s> is pinged from the second reminder on.", sla.EscalateRoleIDs[0])
+		}
+		respondEphemeral(s, i, content+" Reviews written before now are left to `/backlog`.")
+	case "off":
+		if !state.SetRouteReplySLA(i.GuildID, channelID, routing.ReplySLA{}) {
+			respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> won't be reminded about reviews without a reply.", channelID))
+	default:
+		respondEphemeral(s, i, "Unknown sla command")
+	}
+}
+
+// overdue is a review waiting for a reply longer than it should.
+type overdue struct {
+	record history.Record
+	age    time.Duration
+}
+
+func backlogCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	businessUnitIDs := guildBusinessUnitIDs(state, i.GuildID)
+	if len(businessUnitIDs) == 0 {
+		respondEphemeral(s, i, "This server isn't linked to Trustpilot yet, use /login first.")
+		return
+	}
+	routes := state.GetGuildRoutes(i.GuildID)
+	if option, ok := commandOptions(i.ApplicationCommandData().Options)["channel"]; ok {
+		route, ok := guildRoute(state, i.GuildID, idOption(option))
+		if !ok {
+			respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", idOption(option)))
+			return
+		}
+		routes = []routing.Route{route}
+	}
+
+	now := time.Now()
+	var reviews []overdue
+	for _, record := range state.SearchReviews(history.Query{Unreplied: true, BusinessUnitIDs: businessUnitIDs}) {
+		age := now.Sub(record.CreatedAt)
+		if isOverdue(routes, record, age) {
+			reviews = append(reviews, overdue{record, age})
+		}
+	}
+	if len(reviews) == 0 {
+		respondEphemeral(s, i, "No reviews are waiting too long for a reply.")
+		return
+	}
+	// Oldest first, as they've waited longest
+	slices.Reverse(reviews)
+
+	lines := make([]string, 0, maxBacklogLines+1)
+	for _, review := range reviews[:min(len(reviews), maxBacklogLines)] {
+		lines = append(lines, backlogLine(review))
+	}
+	if more := len(reviews) - maxBacklogLines; more > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more.", more))
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{{
+				Title:       "Reply backlog",
+				Description: render.Truncate(strings.Join(lines, "\n"), render.MaxDescription),
+				Color:       render.Review{Stars: 1}.Colour(),
+				Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d %s overdue", len(reviews), render.Plural(len(reviews), "review", "reviews"))},
+			}},
+			Flags:           discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to backlog command", "error", err)
+	}
+}
+
+// isOverdue reports whether record, waiting age for a reply, is overdue in
+// any of routes: past the route's first reminder, or defaultBacklogAge
+// where it has none. Without routes every review of the guild's business
+// units is held to defaultBacklogAge.
+func isOverdue(routes []routing.Route, record history.Record, age time.Duration) bool {
+	if len(routes) == 0 {
+		return age >= defaultBacklogAge
+	}
+	for _, route := range routes {
+		if !route.Matches(record.Review) {
+			continue
+		}
+		if route.ReplySLA.IsZero() {
+			if age >= defaultBacklogAge {
+				return true
+			}
+			continue
+		}
+		if route.ReplySLA.Applies(record.Review) && route.ReplySLA.Level(age) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// backlogLine is an overdue review's line in /backlog.
+func backlogLine(review overdue) string {
+	title := "Untitled review"
+	if review.record.Title != "" {
+		title = render.Escape(render.Truncate(review.record.Title, 80))
+	}
+	if review.record.URL != "" {
+		title = "[" + title + "](" + review.record.URL + ")"
+	}
+	line := fmt.Sprintf("`%s` %s %s", routing.ShortDuration(review.age), review.record.StarBar(), title)
+	if review.record.ConsumerName != "" {
+		line += " by " + render.Escape(review.record.ConsumerName)
+	}
+	return line
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"github.com/liukaku/discord-tp/cmd/digest"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+// SharedState is where the handlers keep and find the bot's state.
+type SharedState interface {
+	AddRoutes(routes ...routing.Route)
+	GetGuildRoutes(guildID string) []routing.Route
+	SetRouteFilter(guildID string, channelID string, filter routing.Filter) bool
+	AddMentionRule(guildID string, channelID string, rule routing.MentionRule) bool
+	RemoveMentionRule(guildID string, channelID string, index int) bool
+	SetQuietHours(guildID string, channelID string, quiet routing.QuietHours) bool
+	SetRouteThreads(guildID string, channelID string, threads bool) bool
+	SetRouteDigest(guildID string, channelID string, d routing.Digest) bool
+	SetRouteReplySLA(guildID string, channelID string, sla routing.ReplySLA) bool
+	GetDigestPeriod(channelID string) digest.Period
+	GetReviewThreads(reviewID string) []types.ReviewThread
+	RemoveReviewThread(reviewID string, threadID string)
+	GetRecentReviews(businessUnitID string, n int) []render.Review
+	SearchReviews(q history.Query) []history.Record
+	MarkReviewReplied(reviewID string)
+	SaveSearch(q history.Query) string
+	GetSearch(searchID string) (history.Query, bool)
+	GetAllowedRoles(guildID string) []string
+	SetAllowedRoles(guildID string, roleIDs ...string)
+	CreateLoginState(guildID string) string
+	GetTrustpilotLink(guildID string) (types.TrustpilotLink, bool)
+	GetEmbedTemplate(guildID string) render.Template
+	SetEmbedTemplate(guildID string, t render.Template)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/digest"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/server/handlers/utils"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+// maxScoreEmbeds is how many business units /trustscore shows at once, the
+// most embeds a message can have
+const maxScoreEmbeds = 10
+
+// statsPeriod is a span /stats can cover, ending now.
+type statsPeriod struct {
+	Name  string
+	Label string
+	// Days is zero for all time
+	Days int
+}
+
+var statsPeriods = []statsPeriod{
+	{"day", "the last 24 hours", 1},
+	{"week", "the last 7 days", 7},
+	{"month", "the last 30 days", 30},
+	{"year", "the last year", 365},
+	{"all", "all time", 0},
+}
+
+// businessUnitOption lets a command pick one of the guild's business units.
+func businessUnitOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "business_unit",
+		Description: description,
+	}
+}
+
+// guildBusinessUnitIDs returns the IDs of the business units guildID's
+// Trustpilot account can see, the only ones its searches may find reviews of.
+func guildBusinessUnitIDs(state SharedState, guildID string) []string {
+	link, _ := state.GetTrustpilotLink(guildID)
+	ids := make([]string, len(link.BusinessUnits))
+	for n, unit := range link.BusinessUnits {
+		ids[n] = unit.ID
+	}
+	return ids
+}
+
+// trustscoreOptions are the /trustscore options.
+func trustscoreOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		businessUnitOption("Business unit name or ID, all of them if empty"),
+	}
+}
+
+// statsOptions are the /stats options.
+func statsOptions() []*discordgo.ApplicationCommandOption {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, len(statsPeriods))
+	for n, period := range statsPeriods {
+		choices[n] = &discordgo.ApplicationCommandOptionChoice{Name: period.Label, Value: period.Name}
+	}
+	return []*discordgo.ApplicationCommandOption{
+		businessUnitOption("Business unit name or ID, all of them if empty"),
+		{Type: discordgo.ApplicationCommandOptionString, Name: "period", Description: "How far back to look, the last 30 days if empty", Choices: choices},
+	}
+}
+
+func trustscoreCommand(cfg *config.Config) InteractionHandler {
+	return func(s Session, i *discordgo.InteractionCreate, state SharedState) {
+		logger := interactionLogger(i)
+		link, ok := state.GetTrustpilotLink(i.GuildID)
+		if !ok {
+			respondEphemeral(s, i, "This server isn't linked to Trustpilot yet, use /login first.")
+			return
+		}
+		unit, wanted, ok := chosenBusinessUnit(i, link)
+		if !ok {
+			respondUnknownBusinessUnit(s, i, wanted)
+			return
+		}
+
+		// Trustpilot can take longer to answer than Discord waits for a response
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
+		if err != nil {
+			logger.Error("cannot defer trustscore response", "error", err)
+			return
+		}
+
+		params := &discordgo.WebhookParams{AllowedMentions: &discordgo.MessageAllowedMentions{}}
+		units, err := businessUnitDetails(cfg.APIURL, link, unit.ID)
+		switch {
+		case err != nil:
+			logger.Error("cannot fetch business units", "error", err)
+			params.Content = "Trustpilot didn't answer, please try again."
+		case len(units) == 0:
+			params.Content = "This Trustpilot account has no business units."
+		}
+		for _, unit := range units {
+			params.Embeds = append(params.Embeds, trustscoreEmbed(unit, cfg.SiteURL))
+		}
+
+		if _, err := s.FollowupMessageCreate(i.Interaction, true, params); err != nil {
+			logger.Error("cannot send trustscore follow-up", "error", err)
+		}
+	}
+}
+
+// chosenBusinessUnit looks up the business unit i's business_unit option
+// names by name or ID among link's. wanted is what the option asked for, and
+// is empty with a zero unit if it was left out; ok is false if no unit matches.
+func chosenBusinessUnit(i *discordgo.InteractionCreate, link types.TrustpilotLink) (unit types.LinkedBusinessUnit, wanted string, ok bool) {
+	if option, ok := commandOptions(i.ApplicationCommandData().Options)["business_unit"]; ok {
+		wanted = strings.TrimSpace(option.StringValue())
+	}
+	if wanted == "" {
+		return types.LinkedBusinessUnit{}, "", true
+	}
+	unit, ok = types.FindBusinessUnit(link.BusinessUnits, wanted)
+	return unit, wanted, ok
+}
+
+// respondUnknownBusinessUnit tells the user there's no business unit by
+// the name or ID wanted.
+func respondUnknownBusinessUnit(s Session, i *discordgo.InteractionCreate, wanted string) {
+	respondEphemeral(s, i, fmt.Sprintf("There's no business unit called %q.", render.NeutraliseMentions(wanted)))
+}
+
+// businessUnitDetails fetches the business unit with id, or all of the ones
+// link can see if id is empty.
+func businessUnitDetails(apiURL string, link types.TrustpilotLink, id string) ([]types.BusinessUnitDetails, error) {
+	if id != "" {
+		details, err := utils.GetBusinessUnitDetails(apiURL, id, link.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		return []types.BusinessUnitDetails{*details}, nil
+	}
+
+	units, err := utils.GetBusinessUnits(apiURL, link.BusinessUserID, link.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []types.BusinessUnitDetails
+	for _, unit := range units.BusinessUnits {
+		details, err := utils.GetBusinessUnitDetails(apiURL, unit.ID, link.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *details)
+		if len(result) == maxScoreEmbeds {
+			break
+		}
+	}
+	return result, nil
+}
+
+// trustscoreEmbed shows a business unit's TrustScore and its reviews' ratings.
+func trustscoreEmbed(unit types.BusinessUnitDetails, siteURL string) *discordgo.MessageEmbed {
+	count := unit.NumberOfReviews
+	embed := &discordgo.MessageEmbed{
+		Title: render.Truncate(unit.DisplayName, render.MaxTitle),
+		Description: fmt.Sprintf("TrustScore **%.1f** · %.1f★ from %d %s",
+			unit.Score.TrustScore, unit.Score.Stars, count.Total, render.Plural(count.Total, "review", "reviews")),
+		Color: render.Review{Stars: int(math.Round(unit.Score.Stars))}.Colour(),
+		Fields: []*discordgo.MessageEmbedField{{
+			Name:  "Ratings",
+			Value: render.Distribution([5]int{count.OneStar, count.TwoStars, count.ThreeStars, count.FourStars, count.FiveStars}),
+		}},
+		Timestamp: time.Now().Format(time.RFC3339),
+		Footer:    &discordgo.MessageEmbedFooter{Text: "Trustpilot"},
+	}
+	if unit.Name.Identifying != "" {
+		embed.URL = strings.TrimSuffix(siteURL, "/") + "/review/" + unit.Name.Identifying
+	}
+	return embed
+}
+
+func statsCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	businessUnitIDs := guildBusinessUnitIDs(state, i.GuildID)
+	if len(businessUnitIDs) == 0 {
+		respondEphemeral(s, i, "This server isn't linked to Trustpilot yet, use /login first.")
+		return
+	}
+	options := commandOptions(i.ApplicationCommandData().Options)
+	period := statsPeriods[2]
+	if option, ok := options["period"]; ok {
+		for _, p := range statsPeriods {
+			if p.Name == option.StringValue() {
+				period = p
+			}
+		}
+	}
+	link, _ := state.GetTrustpilotLink(i.GuildID)
+	unit, wanted, ok := chosenBusinessUnit(i, link)
+	if !ok {
+		respondUnknownBusinessUnit(s, i, wanted)
+		return
+	}
+	if unit.ID != "" {
+		businessUnitIDs = []string{unit.ID}
+	}
+
+	now := time.Now()
+	var since time.Time
+	if period.Days > 0 {
+		since = now.AddDate(0, 0, -period.Days)
+	}
+	records := state.SearchReviews(history.Query{Since: since, BusinessUnitIDs: businessUnitIDs})
+	reviews := make([]render.Review, len(records))
+	for n, record := range records {
+		reviews[n] = record.Review
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:          []*discordgo.MessageEmbed{statsEmbed(digest.Summarize(reviews), unit.Name, period, now)},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to stats command", "error", err)
+	}
+}
+
+// statsEmbed shows the reviews received over period.
+func statsEmbed(summary digest.Summary, businessUnit string, period statsPeriod, now time.Time) *discordgo.MessageEmbed {
+	title := "Review stats"
+	if businessUnit != "" {
+		title += " · " + businessUnit
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:     render.Truncate(title, render.MaxTitle),
+		Color:     render.Review{Stars: int(math.Round(summary.Average))}.Colour(),
+		Timestamp: now.Format(time.RFC3339),
+		Footer:    &discordgo.MessageEmbedFooter{Text: "From the reviews the bot has received"},
+	}
+	if summary.Count == 0 {
+		embed.Description = fmt.Sprintf("No reviews received in %s.", period.Label)
+		return embed
+	}
+
+	embed.Description = fmt.Sprintf("**%d** %s in %s, averaging **%.1f★**.", summary.Count, render.Plural(summary.Count, "review", "reviews"), period.Label, summary.Average)
+	embed.Fields = []*discordgo.MessageEmbedField{{Name: "Ratings", Value: render.Distribution(summary.Stars)}}
+	return embed
+}
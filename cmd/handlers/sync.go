@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SyncPlan describes what a command sync changes on Discord.
+type SyncPlan struct {
+	Create    []string
+	Update    []string
+	Delete    []string
+	Unchanged []string
+}
+
+// Changed reports whether applying the plan would change anything.
+func (p SyncPlan) Changed() bool {
+	return len(p.Create)+len(p.Update)+len(p.Delete) > 0
+}
+
+func (p SyncPlan) String() string {
+	result := ""
+	for _, name := range p.Create {
+		result += fmt.Sprintf("+ %s\n", name)
+	}
+	for _, name := range p.Update {
+		result += fmt.Sprintf("~ %s\n", name)
+	}
+	for _, name := range p.Delete {
+		result += fmt.Sprintf("- %s\n", name)
+	}
+	for _, name := range p.Unchanged {
+		result += fmt.Sprintf("  %s\n", name)
+	}
+	return result
+}
+
+// PlanSync diffs the commands we want registered against the ones Discord has.
+func PlanSync(desired []*discordgo.ApplicationCommand, registered []*discordgo.ApplicationCommand) SyncPlan {
+	var plan SyncPlan
+	existing := map[string]*discordgo.ApplicationCommand{}
+	for _, cmd := range registered {
+		existing[cmd.Name] = cmd
+	}
+
+	for _, cmd := range desired {
+		current, ok := existing[cmd.Name]
+		delete(existing, cmd.Name)
+		switch {
+		case !ok:
+			plan.Create = append(plan.Create, cmd.Name)
+		case !sameCommand(cmd, current):
+			plan.Update = append(plan.Update, cmd.Name)
+		default:
+			plan.Unchanged = append(plan.Unchanged, cmd.Name)
+		}
+	}
+	for _, cmd := range registered {
+		if _, ok := existing[cmd.Name]; ok {
+			plan.Delete = append(plan.Delete, cmd.Name)
+		}
+	}
+	return plan
+}
+
+// SyncCommands makes the commands registered for appID in guildID (or
+// globally when guildID is empty) match desired with a single bulk
+// overwrite. Nothing is sent when the commands already match or dryRun is set.
+func SyncCommands(s Session, appID string, guildID string, desired []*discordgo.ApplicationCommand, dryRun bool) (SyncPlan, error) {
+	registered, err := s.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return SyncPlan{}, fmt.Errorf("error fetching registered commands: %w", err)
+	}
+
+	plan := PlanSync(desired, registered)
+	if dryRun || !plan.Changed() {
+		return plan, nil
+	}
+
+	_, err = s.ApplicationCommandBulkOverwrite(appID, guildID, desired)
+	if err != nil {
+		return plan, fmt.Errorf("error overwriting commands: %w", err)
+	}
+	return plan, nil
+}
+
+// sameCommand compares the parts of a command we declare, ignoring the IDs
+// and versions Discord adds.
+func sameCommand(a *discordgo.ApplicationCommand, b *discordgo.ApplicationCommand) bool {
+	if a.Description != b.Description || commandType(a) != commandType(b) {
+		return false
+	}
+	if permissionsOf(a) != permissionsOf(b) || dmPermissionOf(a) != dmPermissionOf(b) {
+		return false
+	}
+
+	if len(a.Options) == 0 && len(b.Options) == 0 {
+		return true
+	}
+	aOptions, _ := json.Marshal(a.Options)
+	bOptions, _ := json.Marshal(b.Options)
+	return string(aOptions) == string(bOptions)
+}
+
+func commandType(c *discordgo.ApplicationCommand) discordgo.ApplicationCommandType {
+	if c.Type == 0 {
+		return discordgo.ChatApplicationCommand
+	}
+	return c.Type
+}
+
+func permissionsOf(c *discordgo.ApplicationCommand) int64 {
+	if c.DefaultMemberPermissions == nil {
+		return -1
+	}
+	return *c.DefaultMemberPermissions
+}
+
+func dmPermissionOf(c *discordgo.ApplicationCommand) bool {
+	return c.DMPermission == nil || *c.DMPermission
+}
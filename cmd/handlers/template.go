@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// templateInput is a text input in the template modal, prefilled with value.
+func templateInput(customID string, label string, style discordgo.TextInputStyle, value string) discordgo.MessageComponent {
+	return discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.TextInput{
+				CustomID:    customID,
+				Label:       label,
+				Style:       style,
+				Placeholder: "Empty uses the default",
+				Value:       value,
+				MaxLength:   1000,
+			},
+		},
+	}
+}
+
+// templateCommand opens a form for the guild's review embed layout, filled
+// in with the current one.
+func templateCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	current := state.GetEmbedTemplate(i.GuildID)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			Title:    "Review embed template",
+			CustomID: "template-modal",
+			Components: []discordgo.MessageComponent{
+				templateInput("title", "Title", discordgo.TextInputShort, current.Title),
+				templateInput("description", "Description", discordgo.TextInputParagraph, current.Description),
+				templateInput("footer", "Footer", discordgo.TextInputShort, current.Footer),
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot open template modal", "error", err)
+	}
+}
+
+// templateModalSubmit saves the submitted layout if it renders, and shows
+// what a review will look like with it.
+func templateModalSubmit(s Session, i *discordgo.InteractionCreate, state SharedState, params []string) {
+	tmpl := render.Template{
+		Title:       modalValue(i, "title"),
+		Description: modalValue(i, "description"),
+		Footer:      modalValue(i, "footer"),
+	}
+	preview, err := render.Embed(render.SampleReview, tmpl)
+	if err != nil {
+		problem := render.Truncate(err.Error(), render.MaxContent-100)
+		respondEphemeral(s, i, fmt.Sprintf("That template doesn't work, nothing was saved:\n```\n%s\n```", problem))
+		return
+	}
+	state.SetEmbedTemplate(i.GuildID, tmpl)
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Template saved. Reviews will look like this:",
+			Embeds:  []*discordgo.MessageEmbed{preview},
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("cannot respond to template modal", "error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/forum"
+)
+
+// threadsOptions are the /threads options.
+func threadsOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		filterChannelOption("Review channel to start threads in"),
+		{Type: discordgo.ApplicationCommandOptionBoolean, Name: "enabled", Description: "Whether to start a thread on each review", Required: true},
+	}
+}
+
+func threadsCommand(s Session, i *discordgo.InteractionCreate, state SharedState) {
+	options := commandOptions(i.ApplicationCommandData().Options)
+	channelID := idOption(options["channel"])
+	enabled := options["enabled"].BoolValue()
+
+	if route, ok := guildRoute(state, i.GuildID, channelID); ok && route.Forum {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> is a forum, where each review is already a post of its own.", channelID))
+		return
+	}
+	if !state.SetRouteThreads(i.GuildID, channelID, enabled) {
+		respondEphemeral(s, i, fmt.Sprintf("<#%s> isn't a review channel.", channelID))
+		return
+	}
+	if !enabled {
+		respondEphemeral(s, i, fmt.Sprintf("Reviews in <#%s> will be posted without threads.", channelID))
+		return
+	}
+	respondEphemeral(s, i, fmt.Sprintf("Each review in <#%s> will get a thread, which is archived once the review is replied to. The bot needs Create Public Threads there.", channelID))
+}
+
+// setupForum adds the tags the bot applies to review posts to the forum
+// channelID, where it doesn't have them already.
+func setupForum(s Session, channelID string) error {
+	channel, err := s.Channel(channelID)
+	if err != nil {
+		return err
+	}
+	tags, added := forum.MissingTags(channel.AvailableTags)
+	if !added {
+		return nil
+	}
+	_, err = s.ChannelEditComplex(channelID, &discordgo.ChannelEdit{AvailableTags: &tags})
+	return err
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports why a component isn't healthy, or nil if it is.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker answers liveness and readiness probes.
+type Checker struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	started  time.Time
+	draining atomic.Bool
+	timeout  time.Duration
+}
+
+// NewChecker returns a checker whose readiness checks each get timeout to answer.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{started: time.Now(), timeout: timeout}
+}
+
+// Add registers a readiness check for the named component.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name, check})
+}
+
+// SetDraining marks the application as shutting down, which makes it not
+// ready so load balancers stop sending it traffic.
+func (c *Checker) SetDraining(draining bool) {
+	c.draining.Store(draining)
+}
+
+// ComponentStatus is the result of one component's check.
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the body of a probe response.
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Live reports that the process is up. It deliberately checks nothing else,
+// so a broken dependency doesn't get the process restarted.
+func (c *Checker) Live() Report {
+	return Report{
+		Status: "ok",
+		Components: map[string]ComponentStatus{
+			"process": {Status: "ok", Detail: "up " + time.Since(c.started).Round(time.Second).String()},
+		},
+	}
+}
+
+// Ready runs every readiness check in parallel.
+func (c *Checker) Ready(ctx context.Context) (Report, bool) {
+	c.mu.RLock()
+	checks := append([]namedCheck{}, c.checks...)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: "ready", Components: map[string]ComponentStatus{}}
+	ready := true
+	if c.draining.Load() {
+		report.Components["shutdown"] = ComponentStatus{Status: "error", Error: "shutting down"}
+		ready = false
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			status := ComponentStatus{Status: "ok"}
+			if err := nc.check(ctx); err != nil {
+				status = ComponentStatus{Status: "error", Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[nc.name] = status
+			if status.Status != "ok" {
+				ready = false
+			}
+		}(nc)
+	}
+	wg.Wait()
+
+	if !ready {
+		report.Status = "not ready"
+	}
+	return report, ready
+}
+
+// LiveHandler serves Live as JSON.
+func (c *Checker) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.Live(), http.StatusOK)
+}
+
+// ReadyHandler serves Ready as JSON, with a 503 when not ready.
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report, ready := c.Ready(r.Context())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, report, status)
+}
+
+func writeReport(w http.ResponseWriter, report Report, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,243 @@
+// Package history keeps every review the bot has received, with whether it
+// has been replied to, and searches them.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/storage"
+)
+
+// Record is a review as it was received and whether it has been replied to.
+type Record struct {
+	render.Review
+	// RepliedAt is when the review was replied to, zero while it hasn't been
+	RepliedAt time.Time `json:",omitempty"`
+}
+
+// Replied reports whether the review has been replied to.
+func (r Record) Replied() bool {
+	return !r.RepliedAt.IsZero()
+}
+
+// Query picks out reviews. Zero fields match every review.
+type Query struct {
+	MinStars int
+	MaxStars int
+	// Since and Until bound when the review was written, Until excluded
+	Since time.Time
+	Until time.Time
+	// Keyword must appear in the title or text, ignoring case
+	Keyword   string
+	Unreplied bool
+	// BusinessUnitIDs, if any, are the business units the review may be of
+	BusinessUnitIDs []string
+}
+
+// Matches reports whether r is one of the reviews q picks out.
+func (q Query) Matches(r Record) bool {
+	switch {
+	case q.MinStars > 0 && r.Stars < q.MinStars:
+		return false
+	case q.MaxStars > 0 && r.Stars > q.MaxStars:
+		return false
+	case !q.Since.IsZero() && r.CreatedAt.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !r.CreatedAt.Before(q.Until):
+		return false
+	case q.Unreplied && r.Replied():
+		return false
+	case len(q.BusinessUnitIDs) > 0 && !slices.Contains(q.BusinessUnitIDs, r.BusinessUnitID):
+		return false
+	}
+	if q.Keyword == "" {
+		return true
+	}
+	keyword := strings.ToLower(q.Keyword)
+	return strings.Contains(strings.ToLower(r.Title), keyword) || strings.Contains(strings.ToLower(r.Text), keyword)
+}
+
+// document is the name the history's log is saved under
+const document = "history"
+
+// DefaultLimit is how many reviews the history keeps. The ones received
+// longest ago are dropped past it.
+const DefaultLimit = 50_000
+
+// minCompaction is how many entries the log can have before it is worth
+// compacting, however few records are kept
+const minCompaction = 1000
+
+// Store holds the review history. Every change is appended to a log, which
+// is rewritten with only the records kept once it has grown to twice their
+// number, so saving costs the same however long the history is.
+type Store struct {
+	mu sync.RWMutex
+	// store keeps the history between restarts, nil keeps it in memory only
+	store   *storage.Store
+	records []Record
+	// index maps a review ID to its record
+	index map[string]int
+	// limit is how many records are kept
+	limit int
+	// logged is how many entries the log has
+	logged int
+}
+
+// NewStore returns an empty history kept in memory only.
+func NewStore() *Store {
+	return &Store{index: map[string]int{}, limit: DefaultLimit}
+}
+
+// Open returns the history saved in store, which it keeps saving to.
+func Open(store *storage.Store) (*Store, error) {
+	s := NewStore()
+	s.store = store
+	err := store.ReadLog(document, func(entry json.RawMessage) error {
+		var record Record
+		if err := json.Unmarshal(entry, &record); err != nil {
+			return err
+		}
+		s.put(record)
+		s.logged++
+		return nil
+	})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if !s.trim() && s.logged >= 2*max(len(s.records), minCompaction) {
+		s.compact()
+	}
+	return s, nil
+}
+
+// put keeps record, replacing the one with the same ID. It must be called
+// with the lock held.
+func (s *Store) put(record Record) {
+	if n, ok := s.index[record.ID]; ok {
+		s.records[n] = record
+		return
+	}
+	s.index[record.ID] = len(s.records)
+	s.records = append(s.records, record)
+}
+
+// save appends record to the log, reporting whether the history was
+// trimmed instead. It must be called with the lock held.
+func (s *Store) save(record Record) bool {
+	if s.trim() {
+		return true
+	}
+	if s.store == nil {
+		return false
+	}
+	if err := s.store.Append(document, record); err != nil {
+		slog.Error("cannot save review history", "review_id", record.ID, "error", err)
+		return false
+	}
+	s.logged++
+	if s.logged >= 2*max(len(s.records), minCompaction) {
+		s.compact()
+	}
+	return false
+}
+
+// trim drops the records received longest ago past the limit, reporting
+// whether it did. It lets the history grow a tenth over the limit first, so
+// records are dropped in batches rather than one with every review. It must
+// be called with the lock held.
+func (s *Store) trim() bool {
+	if len(s.records) <= s.limit+s.limit/10 {
+		return false
+	}
+	s.records = slices.Clone(s.records[len(s.records)-s.limit:])
+	clear(s.index)
+	for n, record := range s.records {
+		s.index[record.ID] = n
+	}
+	// The dropped records are still in the log
+	s.compact()
+	return true
+}
+
+// compact rewrites the log with only the records kept. It must be called
+// with the lock held.
+func (s *Store) compact() {
+	if s.store == nil {
+		return
+	}
+	entries := make([]any, len(s.records))
+	for n, record := range s.records {
+		entries[n] = record
+	}
+	if err := s.store.ReplaceLog(document, entries); err != nil {
+		slog.Error("cannot compact review history", "error", err)
+		return
+	}
+	s.logged = len(s.records)
+}
+
+// Add keeps review, reporting whether the reviews received longest ago
+// were dropped to make room. A review received again is updated, keeping
+// its reply.
+func (s *Store) Add(review render.Review) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := Record{Review: review}
+	if n, ok := s.index[review.ID]; ok {
+		record.RepliedAt = s.records[n].RepliedAt
+	}
+	s.put(record)
+	return s.save(record)
+}
+
+// MarkReplied records that reviewID was replied to at, reporting false if
+// it isn't in the history.
+func (s *Store) MarkReplied(reviewID string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.index[reviewID]
+	if !ok {
+		return false
+	}
+	if !s.records[n].Replied() {
+		s.records[n].RepliedAt = at
+		s.save(s.records[n])
+	}
+	return true
+}
+
+// Get returns the record of reviewID.
+func (s *Store) Get(reviewID string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.index[reviewID]
+	if !ok {
+		return Record{}, false
+	}
+	return s.records[n], true
+}
+
+// Search returns the reviews q picks out, newest first.
+func (s *Store) Search(q Query) []Record {
+	s.mu.RLock()
+	var result []Record
+	for _, record := range s.records {
+		if q.Matches(record) {
+			result = append(result, record)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortStableFunc(result, func(a, b Record) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return result
+}
@@ -0,0 +1,118 @@
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/storage"
+)
+
+func TestQueryMatches(t *testing.T) {
+	day := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	record := Record{Review: render.Review{Stars: 2, Title: "Late", Text: "The parcel never ARRIVED", BusinessUnit: "Acme", BusinessUnitID: "bu-1", CreatedAt: day}}
+
+	for name, test := range map[string]struct {
+		q    Query
+		want bool
+	}{
+		"everything":           {Query{}, true},
+		"in star range":        {Query{MinStars: 1, MaxStars: 2}, true},
+		"below min stars":      {Query{MinStars: 3}, false},
+		"above max stars":      {Query{MaxStars: 1}, false},
+		"in date range":        {Query{Since: day.Add(-time.Hour), Until: day.Add(time.Hour)}, true},
+		"before since":         {Query{Since: day.Add(time.Hour)}, false},
+		"until is excluded":    {Query{Until: day}, false},
+		"keyword in text":      {Query{Keyword: "arrived"}, true},
+		"keyword in title":     {Query{Keyword: "LATE"}, true},
+		"missing keyword":      {Query{Keyword: "refund"}, false},
+		"unreplied":            {Query{Unreplied: true}, true},
+		"business unit IDs":    {Query{BusinessUnitIDs: []string{"bu-2", "bu-1"}}, true},
+		"other business units": {Query{BusinessUnitIDs: []string{"bu-2"}}, false},
+	} {
+		if got := test.q.Matches(record); got != test.want {
+			t.Errorf("%s: got %t", name, got)
+		}
+	}
+
+	record.RepliedAt = day
+	if (Query{Unreplied: true}).Matches(record) {
+		t.Error("unreplied matched a replied review")
+	}
+}
+
+func TestStoreKeepsReplies(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviews, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	reviews.Add(render.Review{ID: "old", Stars: 1, CreatedAt: day})
+	reviews.Add(render.Review{ID: "new", Stars: 5, CreatedAt: day.Add(time.Hour)})
+	if !reviews.MarkReplied("old", day) || reviews.MarkReplied("missing", day) {
+		t.Fatal("MarkReplied reported the wrong reviews")
+	}
+	// Receiving a review again keeps its reply
+	reviews.Add(render.Review{ID: "old", Stars: 1, Title: "Edited", CreatedAt: day})
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := reopened.Search(Query{})
+	if len(records) != 2 || records[0].ID != "new" || records[1].ID != "old" {
+		t.Fatalf("got %+v, want newest first", records)
+	}
+	if !records[1].Replied() || records[1].Title != "Edited" {
+		t.Errorf("got %+v", records[1])
+	}
+	if unreplied := reopened.Search(Query{Unreplied: true}); len(unreplied) != 1 || unreplied[0].ID != "new" {
+		t.Errorf("got unreplied %+v", unreplied)
+	}
+}
+
+func TestStoreLimitsHistory(t *testing.T) {
+	store, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviews, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviews.limit = 10
+
+	day := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	var trimmed int
+	for n := range 12 {
+		if reviews.Add(render.Review{ID: fmt.Sprint("review-", n), CreatedAt: day.Add(time.Duration(n) * time.Minute)}) {
+			trimmed++
+		}
+	}
+	if trimmed != 1 {
+		t.Errorf("trimmed %d times, want once past a tenth over the limit", trimmed)
+	}
+	reviews.MarkReplied("review-11", day)
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := reopened.Search(Query{})
+	if len(records) != 10 || records[0].ID != "review-11" || records[9].ID != "review-2" {
+		t.Fatalf("got %d records from %s to %s, want the last 10", len(records), records[0].ID, records[len(records)-1].ID)
+	}
+	if !records[0].Replied() {
+		t.Error("reply was lost")
+	}
+	if _, ok := reopened.Get("review-0"); ok {
+		t.Error("kept a review past the limit")
+	}
+}
@@ -0,0 +1,89 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Component is a part of the application that is started and stopped with it.
+type Component struct {
+	Name string
+	// Start must return once the component is up. Long running work belongs
+	// in a goroutine that reports failures through Manager.Fail.
+	Start func(ctx context.Context) error
+	// Stop must return by the time ctx is done.
+	Stop func(ctx context.Context) error
+}
+
+// Manager starts components in the order they were added and stops them in
+// reverse, so each component can rely on the ones added before it.
+type Manager struct {
+	components      []Component
+	shutdownTimeout time.Duration
+	failures        chan error
+}
+
+// New returns a Manager that gives its components shutdownTimeout in total
+// to stop.
+func New(shutdownTimeout time.Duration) *Manager {
+	return &Manager{
+		shutdownTimeout: shutdownTimeout,
+		failures:        make(chan error, 1),
+	}
+}
+
+func (m *Manager) Add(components ...Component) {
+	m.components = append(m.components, components...)
+}
+
+// Fail shuts the application down because of err. Only the first failure is kept.
+func (m *Manager) Fail(err error) {
+	select {
+	case m.failures <- err:
+	default:
+	}
+}
+
+// Run starts every component, waits until ctx is done or a component fails
+// and then stops everything that was started. If a component fails to start
+// the ones before it are stopped and its error is returned straight away.
+func (m *Manager) Run(ctx context.Context) error {
+	var started []Component
+	for _, c := range m.components {
+		slog.Info("starting", "component", c.Name)
+		if err := c.Start(ctx); err != nil {
+			return errors.Join(fmt.Errorf("error starting %s: %w", c.Name, err), m.stop(started))
+		}
+		started = append(started, c)
+	}
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case failure = <-m.failures:
+		slog.Error("shutting down after failure", "error", failure)
+	}
+
+	return errors.Join(failure, m.stop(started))
+}
+
+// stop stops components in reverse order. Every component gets a chance to
+// stop, even if an earlier one overran the deadline.
+func (m *Manager) stop(started []Component) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	var problems []error
+	for n := len(started) - 1; n >= 0; n-- {
+		c := started[n]
+		slog.Info("stopping", "component", c.Name)
+		if err := c.Stop(ctx); err != nil {
+			problems = append(problems, fmt.Errorf("error stopping %s: %w", c.Name, err))
+		}
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// secretKeys are always redacted, whatever the configuration.
+var secretKeys = map[string]bool{
+	"access_token":  true,
+	"token":         true,
+	"discord_token": true,
+	"authorization": true,
+	"admin_token":   true,
+}
+
+// piiKeys are redacted when PII redaction is turned on.
+var piiKeys = map[string]bool{
+	"consumer_name": true,
+	"consumer_id":   true,
+	"username":      true,
+	"review_text":   true,
+	"review_title":  true,
+	"email":         true,
+}
+
+const redacted = "[redacted]"
+
+// Options configures the logger built by New.
+type Options struct {
+	// Level is one of debug, info, warn or error
+	Level string
+	// Format is text or json
+	Format string
+	// RedactPII scrubs consumer names and other personal data as well as secrets
+	RedactPII bool
+}
+
+// New returns a logger writing to w as configured by opts.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", opts.Level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "text", "":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	return slog.New(&contextHandler{&redactingHandler{handler, opts.RedactPII}}), nil
+}
+
+// redactingHandler scrubs secrets, and PII if asked to, from every attribute
+// before it reaches the underlying handler.
+type redactingHandler struct {
+	next      slog.Handler
+	redactPII bool
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	scrubbed := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		scrubbed.AddAttrs(h.redact(attr))
+		return true
+	})
+	return h.next.Handle(ctx, scrubbed)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for n, attr := range attrs {
+		scrubbed[n] = h.redact(attr)
+	}
+	return &redactingHandler{h.next.WithAttrs(scrubbed), h.redactPII}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{h.next.WithGroup(name), h.redactPII}
+}
+
+func (h *redactingHandler) redact(attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	if secretKeys[key] || (h.redactPII && piiKeys[key]) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		group := attr.Value.Group()
+		scrubbed := make([]any, len(group))
+		for n, member := range group {
+			scrubbed[n] = h.redact(member)
+		}
+		return slog.Group(attr.Key, scrubbed...)
+	}
+	return attr
+}
+
+type contextKey struct{}
+
+// WithAttrs returns a context whose log records carry attrs, for anything
+// logged with it through slog's *Context functions.
+func WithAttrs(ctx context.Context, attrs ...any) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]any)
+	return context.WithValue(ctx, contextKey{}, append(append([]any{}, existing...), attrs...))
+}
+
+// contextHandler adds the attributes stored with WithAttrs to each record.
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]any); ok {
+		record.Add(attrs...)
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.next.WithGroup(name)}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	WebhooksReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trustpilot_webhooks_received_total",
+		Help: "Trustpilot webhook events received, by event type.",
+	}, []string{"event"})
+
+	WebhooksRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trustpilot_webhooks_rejected_total",
+		Help: "Trustpilot webhook requests rejected, by event type and reason.",
+	}, []string{"event", "reason"})
+
+	DiscordSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_messages_sent_total",
+		Help: "Messages sent to Discord channels, by guild and outcome.",
+	}, []string{"guild_id", "outcome"})
+
+	TrustpilotRequests = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trustpilot_api_request_duration_seconds",
+		Help:    "Trustpilot API request latency, by method, endpoint and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "endpoint", "code"})
+
+	Interactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_interactions_total",
+		Help: "Discord interactions handled, by guild, command or component and result.",
+	}, []string{"guild_id", "name", "result"})
+
+	EventPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_event_panics_total",
+		Help: "Panics recovered from in gateway event handlers, by event.",
+	}, []string{"event"})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trustpilot_logins_total",
+		Help: "Trustpilot accounts linked through the login flow, by guild and result.",
+	}, []string{"guild_id", "result"})
+)
+
+// RegisterQueueDepth reports the delivery queue's depth, read from depth on every scrape.
+func RegisterQueueDepth(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "delivery_queue_depth",
+		Help: "Messages waiting to be sent to Discord.",
+	}, func() float64 { return float64(depth()) })
+}
+
+// idSegment matches path segments that identify a single resource, which
+// would blow up the endpoint label's cardinality.
+var idSegment = regexp.MustCompile(`^[0-9a-fA-F]{12,}$|^\d+$`)
+
+// Endpoint reduces a Trustpilot API URL to a low cardinality label, so
+// /v1/private/business-units/5b3a... becomes /v1/private/business-units/:id
+func Endpoint(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "unknown"
+	}
+	segments := strings.Split(parsed.Path, "/")
+	for n, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[n] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ObserveTrustpilotRequest records a Trustpilot API call that started at
+// start. A code of 0 means no response was received.
+func ObserveTrustpilotRequest(method string, rawUrl string, code int, start time.Time) {
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+	}
+	TrustpilotRequests.WithLabelValues(method, Endpoint(rawUrl), label).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/handlers"
+)
+
+// registerCommands implements the register-commands subcommand, which syncs
+// the declared commands with Discord without starting the bot.
+func registerCommands(args []string) {
+	flags := flag.NewFlagSet("register-commands", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Print what would change without changing anything")
+	cfg := loadConfig(flags, args)
+
+	session, err := discordgo.New("Bot " + cfg.DiscordToken)
+	if err != nil {
+		fmt.Println("Error creating Discord session, make sure you have the correct token")
+		os.Exit(1)
+	}
+
+	// A bot's application ID is its user ID, so there's no need to open the gateway
+	botUser, err := session.User("@me")
+	if err != nil {
+		fmt.Println("Error fetching bot user:", err)
+		os.Exit(1)
+	}
+
+	router := handlers.NewCommandRouter(cfg)
+	plan, err := handlers.SyncCommands(session, botUser.ID, cfg.GuildID, router.ApplicationCommands(), *dryRun)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	switch {
+	case !plan.Changed():
+		fmt.Print("Commands are already up to date:\n", plan)
+	case *dryRun:
+		fmt.Print("Dry run, would apply:\n", plan)
+	default:
+		fmt.Print("Applied:\n", plan)
+	}
+}
@@ -0,0 +1,36 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// distributionWidth is how many blocks the most common rating's bar gets
+const distributionWidth = 12
+
+// Distribution draws a bar chart of how many reviews have each rating,
+// counts[0] being 1★, from 5★ down.
+func Distribution(counts [5]int) string {
+	most := 0
+	for _, count := range counts {
+		most = max(most, count)
+	}
+	lines := make([]string, 5)
+	for stars := 5; stars >= 1; stars-- {
+		count := counts[stars-1]
+		width := 0
+		if most > 0 {
+			width = (count*distributionWidth + most - 1) / most
+		}
+		lines[5-stars] = fmt.Sprintf("%d★ `%-*s` %d", stars, distributionWidth, strings.Repeat("█", width), count)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Plural returns one when n is 1 and many otherwise.
+func Plural(n int, one string, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,138 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord refuses messages that break any of these limits, counted in characters.
+const (
+	MaxContent     = 2000
+	MaxTitle       = 256
+	MaxDescription = 4096
+	MaxFields      = 25
+	MaxFieldName   = 256
+	MaxFieldValue  = 1024
+	MaxFooter      = 2048
+	MaxAuthorName  = 256
+	MaxEmbedTotal  = 6000
+	MaxThreadName  = 100
+)
+
+const (
+	ellipsis       = "…"
+	zeroWidthSpace = "\u200b"
+	// markdownSpecials are escaped wherever they are, lineStartSpecials
+	// only start headings, lists and quotes at the beginning of a line
+	markdownSpecials  = "\\*_~`|[]()"
+	lineStartSpecials = "#->"
+)
+
+// Truncate shortens s to at most limit characters, ending it with an
+// ellipsis and preferring to cut between words.
+func Truncate(s string, limit int) string {
+	return truncateWith(s, limit, ellipsis)
+}
+
+func truncateWith(s string, limit int, suffix string) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	keep := limit - utf8.RuneCountInString(suffix)
+	if keep <= 0 {
+		return string([]rune(suffix)[:max(limit, 0)])
+	}
+
+	cut := string([]rune(s)[:keep])
+	// Cutting mid-word reads badly, unless it would throw away most of the text
+	if space := strings.LastIndexAny(cut, " \n"); space > len(cut)*3/4 {
+		cut = cut[:space]
+	}
+	// A lone backslash would escape the suffix
+	for strings.HasSuffix(cut, "\\") {
+		cut = cut[:len(cut)-1]
+	}
+	return strings.TrimRight(cut, " \n") + suffix
+}
+
+// Escape stops Discord reading markdown in s, so consumer-written text
+// shows exactly as it was written, and neutralises mentions.
+func Escape(s string) string {
+	var out strings.Builder
+	lineStart := true
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(markdownSpecials, r):
+			out.WriteRune('\\')
+		case lineStart && strings.ContainsRune(lineStartSpecials, r):
+			out.WriteRune('\\')
+		}
+		out.WriteRune(r)
+		lineStart = r == '\n' || (lineStart && (r == ' ' || r == '\t'))
+	}
+	return NeutraliseMentions(out.String())
+}
+
+// NeutraliseMentions breaks up @everyone, @here and user, role and channel
+// mentions so they show as text and can't ping anyone.
+func NeutraliseMentions(s string) string {
+	s = strings.ReplaceAll(s, "@", "@"+zeroWidthSpace)
+	s = strings.ReplaceAll(s, "<#", "<"+zeroWidthSpace+"#")
+	return s
+}
+
+// embedSize is what Discord counts towards MaxEmbedTotal.
+func embedSize(embed *discordgo.MessageEmbed) int {
+	size := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if embed.Footer != nil {
+		size += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	if embed.Author != nil {
+		size += utf8.RuneCountInString(embed.Author.Name)
+	}
+	return size
+}
+
+// readMore is what ends a description that had to be cut short.
+func readMore(url string) string {
+	// A link longer than the text it leaves room for isn't worth it
+	if url == "" || len(url) > MaxDescription/4 {
+		return ellipsis
+	}
+	return ellipsis + " [Read more](" + url + ")"
+}
+
+// enforceLimits trims embed until Discord will accept it. A cut description
+// links to url to read the rest.
+func enforceLimits(embed *discordgo.MessageEmbed, url string) {
+	embed.Title = Truncate(embed.Title, MaxTitle)
+	embed.Description = truncateWith(embed.Description, MaxDescription, readMore(url))
+	if len(embed.Fields) > MaxFields {
+		embed.Fields = embed.Fields[:MaxFields]
+	}
+	for _, field := range embed.Fields {
+		field.Name = Truncate(field.Name, MaxFieldName)
+		field.Value = Truncate(field.Value, MaxFieldValue)
+	}
+	if embed.Footer != nil {
+		embed.Footer.Text = Truncate(embed.Footer.Text, MaxFooter)
+	}
+	if embed.Author != nil {
+		embed.Author.Name = Truncate(embed.Author.Name, MaxAuthorName)
+	}
+
+	// Over the total, the description gives way first as it has the read
+	// more link, then fields go from the end
+	if over := embedSize(embed) - MaxEmbedTotal; over > 0 {
+		length := max(utf8.RuneCountInString(embed.Description)-over, 0)
+		embed.Description = truncateWith(embed.Description, length, readMore(url))
+	}
+	for embedSize(embed) > MaxEmbedTotal && len(embed.Fields) > 0 {
+		embed.Fields = embed.Fields[:len(embed.Fields)-1]
+	}
+}
@@ -0,0 +1,117 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEscape(t *testing.T) {
+	for in, want := range map[string]string{
+		"**bold** and _italic_": `\*\*bold\*\* and \_italic\_`,
+		"# not a heading":       `\# not a heading`,
+		"a # b":                 "a # b",
+		"> quote\n- item":       "\\> quote\n\\- item",
+		"[click](http://x)":     `\[click\]\(http://x\)`,
+		"`code` ||spoiler||":    "\\`code\\` \\|\\|spoiler\\|\\|",
+		`back\slash`:            `back\\slash`,
+	} {
+		if got := Escape(in); got != want {
+			t.Errorf("Escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNeutraliseMentions(t *testing.T) {
+	for _, in := range []string{"@everyone", "@here", "<@123>", "<@!123>", "<@&456>", "<#789>"} {
+		got := NeutraliseMentions(in)
+		if got == in || strings.ReplaceAll(got, zeroWidthSpace, "") != in {
+			t.Errorf("NeutraliseMentions(%q) = %q", in, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := Truncate("short", 10); got != "short" {
+		t.Errorf("got %q", got)
+	}
+	if got := Truncate("the quick brown fox jumps", 20); got != "the quick brown…" {
+		t.Errorf("got %q, want a cut between words", got)
+	}
+	// Multi-byte characters count as one and are never split
+	got := Truncate(strings.Repeat("é", 50), 10)
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != 10 {
+		t.Errorf("got %q", got)
+	}
+	// An escape isn't left dangling at the cut
+	if got := Truncate(strings.Repeat(`\*`, 20), 6); strings.HasSuffix(strings.TrimSuffix(got, ellipsis), `\`) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestEmbedLongReview(t *testing.T) {
+	review := SampleReview
+	review.Text = strings.Repeat("word ", 2000)
+	review.Title = strings.Repeat("t", 500)
+
+	embed, err := Embed(review, Template{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := utf8.RuneCountInString(embed.Title); n > MaxTitle {
+		t.Errorf("title is %d characters", n)
+	}
+	if n := utf8.RuneCountInString(embed.Description); n > MaxDescription {
+		t.Errorf("description is %d characters", n)
+	}
+	if !strings.HasSuffix(embed.Description, "[Read more]("+review.URL+")") {
+		t.Errorf("description doesn't end in a read more link: %q", embed.Description[len(embed.Description)-60:])
+	}
+}
+
+func TestEmbedTotalSize(t *testing.T) {
+	review := SampleReview
+	review.Text = strings.Repeat("x", 5000)
+	review.ConsumerName = strings.Repeat("n", 500)
+	for n := 0; n < 30; n++ {
+		review.Tags = append(review.Tags, Tag{Group: "group", Value: strings.Repeat("v", 100)})
+	}
+
+	embed, err := Embed(review, Template{Footer: strings.Repeat("f", 3000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := embedSize(embed); size > MaxEmbedTotal {
+		t.Errorf("embed is %d characters", size)
+	}
+	if len(embed.Fields) > MaxFields {
+		t.Errorf("embed has %d fields", len(embed.Fields))
+	}
+	for _, field := range embed.Fields {
+		if utf8.RuneCountInString(field.Value) > MaxFieldValue {
+			t.Errorf("field %s is %d characters", field.Name, utf8.RuneCountInString(field.Value))
+		}
+	}
+}
+
+func TestEmbedEscapesConsumerText(t *testing.T) {
+	review := SampleReview
+	review.Title = "**Great** @everyone"
+	review.Text = "Ping <@123> and [phish](http://evil)"
+	review.ConsumerName = "@here_me"
+
+	embed, err := Embed(review, Template{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(embed.Title, `\*\*Great\*\*`) || strings.Contains(embed.Title, "@everyone") {
+		t.Errorf("got title %q", embed.Title)
+	}
+	if strings.Contains(embed.Description, "<@123>") || strings.Contains(embed.Description, "[phish]") {
+		t.Errorf("got description %q", embed.Description)
+	}
+	// Author names don't render markdown, so they aren't escaped
+	if embed.Author.Name != "@"+zeroWidthSpace+"here_me" {
+		t.Errorf("got author %q", embed.Author.Name)
+	}
+}
@@ -0,0 +1,220 @@
+// Package render turns Trustpilot reviews into Discord embeds.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Review is everything about a review that can go into its embed.
+type Review struct {
+	ID           string
+	Title        string
+	Text         string
+	Stars        int
+	Language     string
+	Verified     bool
+	ConsumerName string
+	ConsumerURL  string
+	URL          string
+	BusinessUnit string
+	// BusinessUnitID identifies the business unit BusinessUnit names
+	BusinessUnitID string
+	Tags           []Tag
+	CreatedAt      time.Time
+}
+
+// Tag is a label Trustpilot or the business attached to a review.
+type Tag struct {
+	Group string
+	Value string
+}
+
+// StarBar shows the rating as filled and empty stars, like ★★★★☆.
+func (r Review) StarBar() string {
+	stars := min(max(r.Stars, 0), 5)
+	return strings.Repeat("★", stars) + strings.Repeat("☆", 5-stars)
+}
+
+// Colour is the colour Trustpilot uses for the review's rating.
+func (r Review) Colour() int {
+	switch {
+	case r.Stars <= 1:
+		return 0xFF3722
+	case r.Stars == 2:
+		return 0xFF8622
+	case r.Stars == 3:
+		return 0xFFCE00
+	case r.Stars == 4:
+		return 0x73CF11
+	}
+	return 0x00B67A
+}
+
+// Template is a guild's layout for review embeds. Each part is a Go
+// text/template executed with a Review; empty parts use DefaultTemplate's.
+type Template struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Footer      string `json:"footer,omitempty"`
+}
+
+// DefaultTemplate is the layout used when a guild hasn't set its own.
+var DefaultTemplate = Template{
+	Title:       "{{.StarBar}} {{if .Title}}{{.Title}}{{else}}New review{{end}}",
+	Description: "{{.Text}}",
+	Footer:      "{{if .BusinessUnit}}{{.BusinessUnit}} · {{end}}Trustpilot",
+}
+
+// SampleReview is what templates are checked and previewed against.
+var SampleReview = Review{
+	ID:           "sample",
+	Title:        "Quick delivery",
+	Text:         "Ordered on Monday and it arrived on Tuesday, well packaged.",
+	Stars:        4,
+	Language:     "en",
+	Verified:     true,
+	ConsumerName: "Sam Sample",
+	ConsumerURL:  "https://www.trustpilot.com/users/sample",
+	URL:          "https://www.trustpilot.com/reviews/sample",
+	BusinessUnit: "Example Ltd",
+	Tags:         []Tag{{Group: "source", Value: "invitation"}},
+	CreatedAt:    time.Date(2024, 6, 4, 9, 30, 0, 0, time.UTC),
+}
+
+// withDefaults fills in the parts t leaves empty from DefaultTemplate.
+func (t Template) withDefaults() Template {
+	if strings.TrimSpace(t.Title) == "" {
+		t.Title = DefaultTemplate.Title
+	}
+	if strings.TrimSpace(t.Description) == "" {
+		t.Description = DefaultTemplate.Description
+	}
+	if strings.TrimSpace(t.Footer) == "" {
+		t.Footer = DefaultTemplate.Footer
+	}
+	return t
+}
+
+// Validate reports whether every part of t parses and renders SampleReview.
+func (t Template) Validate() error {
+	_, err := Embed(SampleReview, t)
+	return err
+}
+
+// execute runs the template source named part with r.
+func execute(part string, source string, r Review) (string, error) {
+	tmpl, err := template.New(part).Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", part, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, r); err != nil {
+		return "", fmt.Errorf("%s: %w", part, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// written returns r with everything the consumer or business wrote passed
+// through clean.
+func (r Review) written(clean func(string) string) Review {
+	r.Title = clean(r.Title)
+	r.Text = clean(r.Text)
+	r.ConsumerName = clean(r.ConsumerName)
+	r.Language = clean(r.Language)
+	r.BusinessUnit = clean(r.BusinessUnit)
+	tags := make([]Tag, len(r.Tags))
+	for n, tag := range r.Tags {
+		tags[n] = Tag{Group: clean(tag.Group), Value: clean(tag.Value)}
+	}
+	r.Tags = tags
+	return r
+}
+
+// Embed renders r as a single embed laid out by t, within Discord's limits.
+// Text the consumer wrote is shown as written, without markdown or mentions.
+func Embed(r Review, t Template) (*discordgo.MessageEmbed, error) {
+	t = t.withDefaults()
+	// Titles, descriptions and field values render markdown, footers and
+	// author names don't, so they only need mentions breaking up
+	markdown := r.written(Escape)
+	plain := r.written(NeutraliseMentions)
+
+	title, err := execute("title", t.Title, markdown)
+	if err != nil {
+		return nil, err
+	}
+	description, err := execute("description", t.Description, markdown)
+	if err != nil {
+		return nil, err
+	}
+	footer, err := execute("footer", t.Footer, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: description,
+		URL:         r.URL,
+		Color:       r.Colour(),
+		Fields:      fields(markdown),
+	}
+	if r.ConsumerName != "" {
+		embed.Author = &discordgo.MessageEmbedAuthor{Name: plain.ConsumerName, URL: r.ConsumerURL}
+	}
+	if footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+	}
+	if !r.CreatedAt.IsZero() {
+		embed.Timestamp = r.CreatedAt.Format(time.RFC3339)
+	}
+	enforceLimits(embed, r.URL)
+	return embed, nil
+}
+
+func fields(r Review) []*discordgo.MessageEmbedField {
+	result := []*discordgo.MessageEmbedField{
+		{Name: "Rating", Value: fmt.Sprintf("%s (%d/5)", r.StarBar(), r.Stars), Inline: true},
+	}
+	if r.Language != "" {
+		result = append(result, &discordgo.MessageEmbedField{Name: "Language", Value: r.Language, Inline: true})
+	}
+	if r.Verified {
+		result = append(result, &discordgo.MessageEmbedField{Name: "Verified", Value: "✅ Verified review", Inline: true})
+	}
+	if r.BusinessUnit != "" {
+		result = append(result, &discordgo.MessageEmbedField{Name: "Business unit", Value: r.BusinessUnit, Inline: true})
+	}
+	if len(r.Tags) > 0 {
+		tags := make([]string, len(r.Tags))
+		for n, tag := range r.Tags {
+			tags[n] = tag.Group + ": " + tag.Value
+		}
+		result = append(result, &discordgo.MessageEmbedField{Name: "Tags", Value: strings.Join(tags, ", ")})
+	}
+	return result
+}
+
+// ThreadName names the thread a review is discussed in, like
+// "2★ · Jane · Late delivery".
+func ThreadName(r Review) string {
+	name := fmt.Sprintf("%d★", r.Stars)
+	if r.ConsumerName != "" {
+		name += " · " + r.ConsumerName
+	}
+	if r.Title != "" {
+		name += " · " + r.Title
+	}
+	return Truncate(strings.Join(strings.Fields(name), " "), MaxThreadName)
+}
+
+// ResolvedThreadName renames a review's thread once it has been replied to.
+func ResolvedThreadName(name string) string {
+	return Truncate("✅ Resolved · "+name, MaxThreadName)
+}
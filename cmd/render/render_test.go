@@ -0,0 +1,103 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStarBar(t *testing.T) {
+	for stars, want := range map[int]string{0: "☆☆☆☆☆", 3: "★★★☆☆", 5: "★★★★★", 7: "★★★★★"} {
+		if got := (Review{Stars: stars}).StarBar(); got != want {
+			t.Errorf("%d stars: got %q, want %q", stars, got, want)
+		}
+	}
+}
+
+func TestEmbedDefaultTemplate(t *testing.T) {
+	embed, err := Embed(SampleReview, Template{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if embed.Title != "★★★★☆ Quick delivery" {
+		t.Errorf("got title %q", embed.Title)
+	}
+	if embed.Description != SampleReview.Text {
+		t.Errorf("got description %q", embed.Description)
+	}
+	if embed.Color != 0x73CF11 {
+		t.Errorf("got colour %06x", embed.Color)
+	}
+	if embed.Author == nil || embed.Author.Name != "Sam Sample" || embed.Author.URL != SampleReview.ConsumerURL {
+		t.Errorf("got author %+v", embed.Author)
+	}
+	if embed.Footer == nil || !strings.Contains(embed.Footer.Text, "Example Ltd") {
+		t.Errorf("got footer %+v", embed.Footer)
+	}
+	if embed.Timestamp != "2024-06-04T09:30:00Z" {
+		t.Errorf("got timestamp %q", embed.Timestamp)
+	}
+
+	names := map[string]bool{}
+	for _, field := range embed.Fields {
+		names[field.Name] = true
+	}
+	for _, name := range []string{"Rating", "Language", "Verified", "Business unit", "Tags"} {
+		if !names[name] {
+			t.Errorf("no %s field in %+v", name, embed.Fields)
+		}
+	}
+}
+
+func TestEmbedCustomTemplate(t *testing.T) {
+	embed, err := Embed(SampleReview, Template{Description: "{{.Text}}\n— {{.ConsumerName}} ({{.Language}})"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embed.Description != SampleReview.Text+"\n— Sam Sample (en)" {
+		t.Errorf("got description %q", embed.Description)
+	}
+	if embed.Title != "★★★★☆ Quick delivery" {
+		t.Errorf("unset parts should use the default, got title %q", embed.Title)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Template{Footer: "{{.BusinessUnit}}"}).Validate(); err != nil {
+		t.Errorf("valid template: %v", err)
+	}
+	for _, tmpl := range []Template{{Title: "{{.Title"}, {Description: "{{.Missing}}"}, {Footer: "{{index .Tags 5}}"}} {
+		if err := tmpl.Validate(); err == nil {
+			t.Errorf("%+v validated", tmpl)
+		}
+	}
+}
+
+func TestThreadName(t *testing.T) {
+	review := Review{Stars: 2, ConsumerName: "Jane  Doe", Title: "Late\ndelivery"}
+	if got := ThreadName(review); got != "2★ · Jane Doe · Late delivery" {
+		t.Errorf("got %q", got)
+	}
+
+	review.Title = strings.Repeat("long ", 40)
+	if got := ThreadName(review); utf8.RuneCountInString(got) > MaxThreadName {
+		t.Errorf("got %d characters", utf8.RuneCountInString(got))
+	}
+	if got := ResolvedThreadName(ThreadName(review)); !strings.HasPrefix(got, "✅ Resolved · 2★") || utf8.RuneCountInString(got) > MaxThreadName {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	lines := strings.Split(Distribution([5]int{1, 0, 0, 2, 4}), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	for n, want := range []string{"5★ `████████████` 4", "4★ `██████      ` 2", "3★ `            ` 0", "1★ `███         ` 1"} {
+		line := lines[[]int{0, 1, 2, 4}[n]]
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// MentionRule pings roles and users when a review passes Filter. A route's
+// rules are checked independently, so "≤ 2★ or mentions refund" is two rules.
+type MentionRule struct {
+	Filter  Filter
+	RoleIDs []string `json:",omitempty"`
+	UserIDs []string `json:",omitempty"`
+}
+
+// String describes r for people, like "<@&123> for up to 2★".
+func (r MentionRule) String() string {
+	var targets []string
+	for _, id := range r.RoleIDs {
+		targets = append(targets, "<@&"+id+">")
+	}
+	for _, id := range r.UserIDs {
+		targets = append(targets, "<@"+id+">")
+	}
+	return strings.Join(targets, " ") + " for " + r.Filter.String()
+}
+
+// Mentions are who a review's message pings.
+type Mentions struct {
+	RoleIDs []string
+	UserIDs []string
+}
+
+// IsZero reports whether m pings nobody.
+func (m Mentions) IsZero() bool {
+	return len(m.RoleIDs) == 0 && len(m.UserIDs) == 0
+}
+
+// Content is the message text that pings m.
+func (m Mentions) Content() string {
+	var parts []string
+	for _, id := range m.RoleIDs {
+		parts = append(parts, "<@&"+id+">")
+	}
+	for _, id := range m.UserIDs {
+		parts = append(parts, "<@"+id+">")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Mentions returns who to ping about review at now: everyone named by a
+// matching rule, or nobody during the route's quiet hours.
+func (r Route) Mentions(review render.Review, now time.Time) Mentions {
+	var m Mentions
+	if r.QuietHours.Contains(now) {
+		return m
+	}
+	for _, rule := range r.MentionRules {
+		if !rule.Filter.Matches(review) {
+			continue
+		}
+		for _, id := range rule.RoleIDs {
+			if !slices.Contains(m.RoleIDs, id) {
+				m.RoleIDs = append(m.RoleIDs, id)
+			}
+		}
+		for _, id := range rule.UserIDs {
+			if !slices.Contains(m.UserIDs, id) {
+				m.UserIDs = append(m.UserIDs, id)
+			}
+		}
+	}
+	return m
+}
+
+// Escalates reports whether review is one of those the route pings people
+// about, even if it arrives during quiet hours.
+func (r Route) Escalates(review render.Review) bool {
+	return slices.ContainsFunc(r.MentionRules, func(rule MentionRule) bool {
+		return rule.Filter.Matches(review)
+	})
+}
+
+// QuietHours is a daily window, in Timezone, when reviews are posted
+// without pinging anyone. The zero QuietHours is never quiet.
+type QuietHours struct {
+	// Start and End are "15:04" times; a window past midnight ends the next day
+	Start    string `json:",omitempty"`
+	End      string `json:",omitempty"`
+	Timezone string `json:",omitempty"`
+}
+
+// ParseQuietHours checks start and end are times of day and timezone is an
+// IANA name like "Europe/London", empty meaning UTC.
+func ParseQuietHours(start string, end string, timezone string) (QuietHours, error) {
+	q := QuietHours{Start: strings.TrimSpace(start), End: strings.TrimSpace(end), Timezone: strings.TrimSpace(timezone)}
+	if _, err := time.Parse("15:04", q.Start); err != nil {
+		return QuietHours{}, fmt.Errorf("start %q isn't a time like 22:00", start)
+	}
+	if _, err := time.Parse("15:04", q.End); err != nil {
+		return QuietHours{}, fmt.Errorf("end %q isn't a time like 07:30", end)
+	}
+	if q.Start == q.End {
+		return QuietHours{}, fmt.Errorf("start and end are both %s", q.Start)
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return QuietHours{}, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	return q, nil
+}
+
+// IsZero reports whether q is never quiet.
+func (q QuietHours) IsZero() bool {
+	return q.Start == "" && q.End == ""
+}
+
+// Contains reports whether t falls in the quiet window.
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.IsZero() {
+		return false
+	}
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return false
+	}
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from < to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// String describes q for people, like "22:00–07:00 Europe/London".
+func (q QuietHours) String() string {
+	if q.IsZero() {
+		return "none"
+	}
+	timezone := q.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	return q.Start + "–" + q.End + " " + timezone
+}
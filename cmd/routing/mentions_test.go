@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+func TestRouteMentions(t *testing.T) {
+	route := Route{MentionRules: []MentionRule{
+		{Filter: Filter{MaxStars: 2}, RoleIDs: []string{"support"}},
+		{Filter: Filter{Include: []string{"refund"}}, RoleIDs: []string{"support"}, UserIDs: []string{"finance-lead"}},
+	}}
+	noon := time.Date(2024, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	for name, test := range map[string]struct {
+		review render.Review
+		want   Mentions
+	}{
+		"happy":         {render.Review{Stars: 5, Text: "Great"}, Mentions{}},
+		"low rating":    {render.Review{Stars: 1, Text: "Awful"}, Mentions{RoleIDs: []string{"support"}}},
+		"refund":        {render.Review{Stars: 4, Text: "Got a REFUND quickly"}, Mentions{RoleIDs: []string{"support"}, UserIDs: []string{"finance-lead"}}},
+		"both, deduped": {render.Review{Stars: 1, Text: "Still waiting for my refund"}, Mentions{RoleIDs: []string{"support"}, UserIDs: []string{"finance-lead"}}},
+	} {
+		if got := route.Mentions(test.review, noon); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, test.want)
+		}
+	}
+
+	route.QuietHours = QuietHours{Start: "11:00", End: "13:00"}
+	if got := route.Mentions(render.Review{Stars: 1}, noon); !got.IsZero() {
+		t.Errorf("pinged %+v during quiet hours", got)
+	}
+}
+
+func TestMentionsContent(t *testing.T) {
+	m := Mentions{RoleIDs: []string{"1", "2"}, UserIDs: []string{"3"}}
+	if got := m.Content(); got != "<@&1> <@&2> <@3>" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight, err := ParseQuietHours("22:00", "07:30", "Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for clock, want := range map[string]bool{
+		// British summer time is UTC+1
+		"2024-06-04T20:59:00Z": false,
+		"2024-06-04T21:00:00Z": true,
+		"2024-06-05T03:00:00Z": true,
+		"2024-06-05T06:29:00Z": true,
+		"2024-06-05T06:30:00Z": false,
+	} {
+		at, _ := time.Parse(time.RFC3339, clock)
+		if got := overnight.Contains(at); got != want {
+			t.Errorf("%s: got %v, want %v", clock, got, want)
+		}
+	}
+
+	if (QuietHours{}).Contains(time.Now()) {
+		t.Error("zero quiet hours are quiet")
+	}
+}
+
+func TestParseQuietHoursRejects(t *testing.T) {
+	for _, args := range [][3]string{
+		{"25:00", "07:00", ""},
+		{"22:00", "7am", ""},
+		{"22:00", "22:00", ""},
+		{"22:00", "07:00", "Mars/Olympus_Mons"},
+	} {
+		if _, err := ParseQuietHours(args[0], args[1], args[2]); err == nil {
+			t.Errorf("%v parsed", args)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package routing decides which channels a review is delivered to.
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// Route delivers reviews of a business unit that pass Filter to a channel.
+type Route struct {
+	GuildID   string
+	ChannelID string
+	// BusinessUnitID is the business unit the route gets reviews of; a route
+	// without one gets none
+	BusinessUnitID string `json:",omitempty"`
+	Filter         Filter
+	// MentionRules say who to ping about the reviews posted, outside QuietHours
+	MentionRules []MentionRule `json:",omitempty"`
+	QuietHours   QuietHours
+	// Threads starts a thread on each review posted, for discussing it
+	Threads bool `json:",omitempty"`
+	// Forum routes post each review as a post in a forum channel
+	Forum bool `json:",omitempty"`
+	// Digest summarises the route's reviews on a schedule
+	Digest Digest
+	// ReplySLA reminds the route about reviews nobody has replied to
+	ReplySLA ReplySLA
+}
+
+// Matches reports whether review is for the route's business unit and
+// passes its filter.
+func (r Route) Matches(review render.Review) bool {
+	return r.BusinessUnitID != "" && review.BusinessUnitID == r.BusinessUnitID && r.Filter.Matches(review)
+}
+
+// Digest is when a route gets a summary of its reviews.
+type Digest struct {
+	// Schedule is a cron expression in Timezone, empty for no digests
+	Schedule string `json:",omitempty"`
+	Timezone string `json:",omitempty"`
+	// Only keeps reviews for the digest instead of posting them as they arrive
+	Only bool `json:",omitempty"`
+}
+
+// IsZero reports whether d sends no digests.
+func (d Digest) IsZero() bool {
+	return d.Schedule == ""
+}
+
+// TagMatch matches reviews with a tag in Group. An empty Value matches any
+// tag in the group.
+type TagMatch struct {
+	Group string
+	Value string
+}
+
+// Filter decides which reviews a route gets. The zero Filter lets every
+// review through; each rule that is set must pass.
+type Filter struct {
+	// MinStars and MaxStars bound the rating, 0 leaves that end open
+	MinStars int `json:",omitempty"`
+	MaxStars int `json:",omitempty"`
+	// Languages the review must be written in, "en" also matches "en-GB"
+	Languages    []string `json:",omitempty"`
+	VerifiedOnly bool     `json:",omitempty"`
+	// Tags the review must have at least one of
+	Tags []TagMatch `json:",omitempty"`
+	// Include are keywords of which at least one must be in the title or
+	// text, Exclude keywords none may be. Both ignore case.
+	Include []string `json:",omitempty"`
+	Exclude []string `json:",omitempty"`
+}
+
+// IsZero reports whether f lets every review through.
+func (f Filter) IsZero() bool {
+	return f.MinStars == 0 && f.MaxStars == 0 && len(f.Languages) == 0 && !f.VerifiedOnly &&
+		len(f.Tags) == 0 && len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Validate reports rules that could never match.
+func (f Filter) Validate() error {
+	if f.MinStars < 0 || f.MinStars > 5 || f.MaxStars < 0 || f.MaxStars > 5 {
+		return fmt.Errorf("stars must be between 1 and 5")
+	}
+	if f.MaxStars != 0 && f.MinStars > f.MaxStars {
+		return fmt.Errorf("minimum stars %d is above the maximum %d", f.MinStars, f.MaxStars)
+	}
+	return nil
+}
+
+// Matches reports whether r passes every rule in f.
+func (f Filter) Matches(r render.Review) bool {
+	if f.MinStars != 0 && r.Stars < f.MinStars {
+		return false
+	}
+	if f.MaxStars != 0 && r.Stars > f.MaxStars {
+		return false
+	}
+	if f.VerifiedOnly && !r.Verified {
+		return false
+	}
+	if len(f.Languages) > 0 && !matchesLanguage(f.Languages, r.Language) {
+		return false
+	}
+	if len(f.Tags) > 0 && !matchesTag(f.Tags, r.Tags) {
+		return false
+	}
+
+	text := strings.ToLower(r.Title + "\n" + r.Text)
+	if len(f.Include) > 0 && !containsAny(text, f.Include) {
+		return false
+	}
+	return !containsAny(text, f.Exclude)
+}
+
+func matchesLanguage(languages []string, language string) bool {
+	language = strings.ToLower(language)
+	for _, want := range languages {
+		want = strings.ToLower(want)
+		if language == want || strings.HasPrefix(language, want+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesTag(matches []TagMatch, tags []render.Tag) bool {
+	for _, match := range matches {
+		for _, tag := range tags {
+			if strings.EqualFold(tag.Group, match.Group) && (match.Value == "" || strings.EqualFold(tag.Value, match.Value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes f for people, like "1–2★, en, verified only".
+func (f Filter) String() string {
+	if f.IsZero() {
+		return "every review"
+	}
+
+	var parts []string
+	switch {
+	case f.MinStars != 0 && f.MaxStars != 0 && f.MinStars == f.MaxStars:
+		parts = append(parts, fmt.Sprintf("%d★", f.MinStars))
+	case f.MinStars != 0 && f.MaxStars != 0:
+		parts = append(parts, fmt.Sprintf("%d–%d★", f.MinStars, f.MaxStars))
+	case f.MinStars != 0:
+		parts = append(parts, fmt.Sprintf("%d★ and up", f.MinStars))
+	case f.MaxStars != 0:
+		parts = append(parts, fmt.Sprintf("up to %d★", f.MaxStars))
+	}
+	if len(f.Languages) > 0 {
+		parts = append(parts, strings.Join(f.Languages, "/"))
+	}
+	if f.VerifiedOnly {
+		parts = append(parts, "verified only")
+	}
+	if len(f.Tags) > 0 {
+		tags := make([]string, len(f.Tags))
+		for n, tag := range f.Tags {
+			tags[n] = tag.Group
+			if tag.Value != "" {
+				tags[n] += "=" + tag.Value
+			}
+		}
+		parts = append(parts, "tagged "+strings.Join(tags, " or "))
+	}
+	if len(f.Include) > 0 {
+		parts = append(parts, "mentioning "+strings.Join(f.Include, " or "))
+	}
+	if len(f.Exclude) > 0 {
+		parts = append(parts, "not mentioning "+strings.Join(f.Exclude, " or "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseList splits a comma separated list, dropping empty entries.
+func ParseList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// ParseTags parses a comma separated list of group or group=value tags.
+func ParseTags(s string) []TagMatch {
+	var result []TagMatch
+	for _, item := range ParseList(s) {
+		group, value, _ := strings.Cut(item, "=")
+		result = append(result, TagMatch{Group: strings.TrimSpace(group), Value: strings.TrimSpace(value)})
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+func TestFilterMatches(t *testing.T) {
+	review := render.Review{
+		Title:    "Late delivery",
+		Text:     "The parcel came a week late.",
+		Stars:    2,
+		Language: "en-GB",
+		Verified: true,
+		Tags:     []render.Tag{{Group: "source", Value: "invitation"}},
+	}
+
+	for name, test := range map[string]struct {
+		filter Filter
+		want   bool
+	}{
+		"zero":              {Filter{}, true},
+		"in star range":     {Filter{MinStars: 1, MaxStars: 2}, true},
+		"below min stars":   {Filter{MinStars: 3}, false},
+		"above max stars":   {Filter{MaxStars: 1}, false},
+		"language prefix":   {Filter{Languages: []string{"de", "EN"}}, true},
+		"other language":    {Filter{Languages: []string{"de"}}, false},
+		"verified only":     {Filter{VerifiedOnly: true}, true},
+		"tag group":         {Filter{Tags: []TagMatch{{Group: "source"}}}, true},
+		"tag value":         {Filter{Tags: []TagMatch{{Group: "source", Value: "organic"}}}, false},
+		"included keyword":  {Filter{Include: []string{"refund", "DELIVERY"}}, true},
+		"missing keyword":   {Filter{Include: []string{"refund"}}, false},
+		"excluded keyword":  {Filter{Exclude: []string{"parcel"}}, false},
+		"every rule passes": {Filter{MaxStars: 2, Languages: []string{"en"}, VerifiedOnly: true, Exclude: []string{"refund"}}, true},
+	} {
+		if got := test.filter.Matches(review); got != test.want {
+			t.Errorf("%s: got %v, want %v", name, got, test.want)
+		}
+	}
+
+	if (Filter{VerifiedOnly: true}).Matches(render.Review{Stars: 5}) {
+		t.Error("verified only matched an unverified review")
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	for _, filter := range []Filter{{MinStars: 4, MaxStars: 2}, {MinStars: 6}, {MaxStars: -1}} {
+		if filter.Validate() == nil {
+			t.Errorf("%+v is valid", filter)
+		}
+	}
+	if err := (Filter{MinStars: 2, MaxStars: 2}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	for want, filter := range map[string]Filter{
+		"every review":                  {},
+		"1–2★, en, verified only":       {MinStars: 1, MaxStars: 2, Languages: []string{"en"}, VerifiedOnly: true},
+		"4★ and up, tagged source=paid": {MinStars: 4, Tags: []TagMatch{{Group: "source", Value: "paid"}}},
+		"3★, not mentioning spam":       {MinStars: 3, MaxStars: 3, Exclude: []string{"spam"}},
+	} {
+		if got := filter.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got := ParseTags(" source = invitation, ,priority")
+	want := []TagMatch{{Group: "source", Value: "invitation"}, {Group: "priority"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
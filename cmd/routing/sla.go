@@ -0,0 +1,131 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+// maxReminders keeps a review's reminders down to a few escalations
+const maxReminders = 5
+
+// ReplySLA is how soon a route's reviews should be replied to. A review
+// still waiting for a reply gets a reminder as it passes each of Reminders.
+type ReplySLA struct {
+	// Reminders are how long after a review is written each reminder is
+	// sent, shortest first; none turns reminders off
+	Reminders []time.Duration `json:",omitempty"`
+	// MaxStars limits reminders to reviews of up to this rating, 0 for all
+	MaxStars int `json:",omitempty"`
+	// EscalateRoleIDs are pinged from the second reminder on
+	EscalateRoleIDs []string `json:",omitempty"`
+	// Since is when reminders were turned on; reviews written before are
+	// left to /backlog rather than all reminded about at once
+	Since time.Time
+}
+
+// IsZero reports whether s sends no reminders.
+func (s ReplySLA) IsZero() bool {
+	return len(s.Reminders) == 0
+}
+
+// Applies reports whether review should get reminders.
+func (s ReplySLA) Applies(review render.Review) bool {
+	return !s.IsZero() && (s.MaxStars == 0 || review.Stars <= s.MaxStars)
+}
+
+// Level is how many reminders are due for a review waiting age for a reply.
+func (s ReplySLA) Level(age time.Duration) int {
+	level := 0
+	for _, after := range s.Reminders {
+		if age >= after {
+			level++
+		}
+	}
+	return level
+}
+
+// String describes s for people, like "after 1d and 2d for up to 2★".
+func (s ReplySLA) String() string {
+	if s.IsZero() {
+		return "off"
+	}
+	afters := make([]string, len(s.Reminders))
+	for n, after := range s.Reminders {
+		afters[n] = ShortDuration(after)
+	}
+	description := "after " + strings.Join(afters, ", ")
+	if len(afters) > 1 {
+		description = "after " + strings.Join(afters[:len(afters)-1], ", ") + " and " + afters[len(afters)-1]
+	}
+	if s.MaxStars > 0 {
+		description += fmt.Sprintf(" for up to %d★", s.MaxStars)
+	}
+	return description
+}
+
+// ParseReminders parses a comma separated list of durations like "24h,2d",
+// which may use d for days, into reminders shortest first.
+func ParseReminders(s string) ([]time.Duration, error) {
+	var reminders []time.Duration
+	for _, part := range ParseList(s) {
+		after, err := parseDays(part)
+		if err != nil {
+			return nil, err
+		}
+		if after <= 0 {
+			return nil, fmt.Errorf("%q isn't after the review", part)
+		}
+		if !slices.Contains(reminders, after) {
+			reminders = append(reminders, after)
+		}
+	}
+	if len(reminders) == 0 {
+		return nil, fmt.Errorf("give at least one time, like 24h")
+	}
+	if len(reminders) > maxReminders {
+		return nil, fmt.Errorf("give at most %d times", maxReminders)
+	}
+	slices.Sort(reminders)
+	return reminders, nil
+}
+
+// parseDays parses a Go duration, or a whole number of days like "2d".
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("%q isn't a number of days", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a time like 24h or 2d", s)
+	}
+	return d, nil
+}
+
+// ShortDuration formats d to the minute for people, like "1d 6h" or "45m".
+func ShortDuration(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	days, hours, minutes := int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour), int(d%time.Hour/time.Minute)
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 && days == 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if len(parts) == 0 {
+		return "0m"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,54 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+)
+
+func TestParseReminders(t *testing.T) {
+	got, err := ParseReminders("2d, 24h,36h,1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{24 * time.Hour, 36 * time.Hour, 48 * time.Hour}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, s := range []string{"", "soon", "xd", "-1h", "0d", "1h,2h,3h,4h,5h,6h"} {
+		if _, err := ParseReminders(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestReplySLA(t *testing.T) {
+	sla := ReplySLA{Reminders: []time.Duration{24 * time.Hour, 48 * time.Hour}, MaxStars: 2}
+	if sla.Applies(render.Review{Stars: 3}) || !sla.Applies(render.Review{Stars: 2}) || (ReplySLA{}).Applies(render.Review{Stars: 1}) {
+		t.Error("applies to the wrong reviews")
+	}
+	for age, want := range map[time.Duration]int{time.Hour: 0, 24 * time.Hour: 1, 47 * time.Hour: 1, 72 * time.Hour: 2} {
+		if got := sla.Level(age); got != want {
+			t.Errorf("after %s: got level %d, want %d", age, got, want)
+		}
+	}
+	if got := sla.String(); got != "after 1d and 2d for up to 2★" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		30 * time.Second:              "0m",
+		45 * time.Minute:              "45m",
+		5*time.Hour + 3*time.Minute:   "5h 3m",
+		36 * time.Hour:                "1d 12h",
+		72*time.Hour + 10*time.Minute: "3d",
+		-2 * time.Hour:                "0m",
+	} {
+		if got := ShortDuration(d); got != want {
+			t.Errorf("%s: got %q, want %q", d, got, want)
+		}
+	}
+}
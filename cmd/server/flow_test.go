@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/discordtest"
+	"github.com/liukaku/discord-tp/cmd/health"
+	"github.com/liukaku/discord-tp/cmd/trustpilottest"
+)
+
+const webhookSecret = "webhook-secret"
+
+// botServer runs the bot's HTTP server against a fake Trustpilot, with
+// messages delivered to a fake Discord session.
+type botServer struct {
+	*httptest.Server
+	trustpilot *trustpilottest.Server
+	discord    *discordtest.Session
+	state      *fakeState
+	queue      *delivery.Queue
+}
+
+func newBotServer(t *testing.T) *botServer {
+	t.Helper()
+	trustpilot := trustpilottest.NewServer(t)
+	cfg := config.Default()
+	cfg.APIURL = trustpilot.URL
+	cfg.WebhookOrigin = trustpilot.URL
+	cfg.SiteURL = "https://www.example.com"
+	cfg.WebhookSecret = webhookSecret
+
+	session := discordtest.NewSession()
+	queue := delivery.NewQueue(10, func(m delivery.Message) error {
+		return delivery.Deliver(session, m)
+	})
+	queue.Start(context.Background())
+	state := &fakeState{routes: routesTo("channel-1"), loginStates: map[string]string{"login-state": "guild-1"}}
+
+	b := &botServer{
+		Server:     httptest.NewServer(NewHandler(&cfg, nil, state, queue, health.NewChecker(time.Second))),
+		trustpilot: trustpilot,
+		discord:    session,
+		state:      state,
+		queue:      queue,
+	}
+	t.Cleanup(b.Close)
+	return b
+}
+
+// storeToken posts what the auth page would after the Trustpilot login.
+func (b *botServer) storeToken(t *testing.T, accessToken string) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"expires_in":   "3600",
+		"state":        "login-state",
+	})
+	resp, err := http.Post(b.URL+"/store-token", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func (b *botServer) drain(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.queue.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginToPostedReview(t *testing.T) {
+	b := newBotServer(t)
+
+	if resp := b.storeToken(t, trustpilottest.AccessToken); resp.StatusCode != http.StatusOK {
+		t.Fatalf("storing the token got %s", resp.Status)
+	}
+	link, ok := b.state.links["guild-1"]
+	if !ok || link.BusinessUserID != "business-user-1" || link.AccessToken != trustpilottest.AccessToken {
+		t.Fatalf("got link %+v", link)
+	}
+	if buids := b.state.GetBuids(); len(buids) != 1 || buids[0] != "Acme" {
+		t.Errorf("got business units %v", buids)
+	}
+
+	webhook := b.trustpilot.ReviewWebhook(trustpilottest.Review{ID: "review1", Text: "Lovely service", Stars: 5, ConsumerName: "Jane"})
+	resp, err := trustpilottest.SendWebhook(b.URL+"/trustpilot", webhookSecret, webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("webhook got %s", resp.Status)
+	}
+	b.drain(t)
+
+	var posted bool
+	for _, send := range b.discord.Sends() {
+		if len(send.Message.Embeds) > 0 && send.ChannelID == "channel-1" {
+			posted = true
+			if url := send.Message.Embeds[0].URL; url != "https://www.example.com/reviews/review1" {
+				t.Errorf("got review link %q", url)
+			}
+		}
+	}
+	if !posted {
+		t.Errorf("review wasn't posted, sends: %+v", b.discord.Sends())
+	}
+}
+
+func TestStoreTokenTrustpilotFailures(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError} {
+		b := newBotServer(t)
+		b.trustpilot.FailNext("/v1/private/me", status)
+
+		if resp := b.storeToken(t, trustpilottest.AccessToken); resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Trustpilot %d: got %s", status, resp.Status)
+		}
+		if _, ok := b.state.links["guild-1"]; ok {
+			t.Errorf("Trustpilot %d: guild was linked anyway", status)
+		}
+	}
+}
+
+func TestStoreTokenRejectsUnknownToken(t *testing.T) {
+	b := newBotServer(t)
+	if resp := b.storeToken(t, "not-a-token"); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got %s", resp.Status)
+	}
+}
+
+func TestWebhookAuth(t *testing.T) {
+	b := newBotServer(t)
+	webhook := b.trustpilot.ReviewWebhook(trustpilottest.Review{ID: "review1", Text: "Lovely service", Stars: 5})
+
+	for name, secret := range map[string]string{"no credentials": "", "wrong secret": "guess"} {
+		resp, err := trustpilottest.SendWebhook(b.URL+"/trustpilot", secret, webhook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: got %s, want 401", name, resp.Status)
+		}
+	}
+
+	b.drain(t)
+	if sends := b.discord.Sends(); len(sends) != 0 {
+		t.Errorf("sent %d messages for refused webhooks", len(sends))
+	}
+}
+
+func TestWebhookWithoutSecretNeedsOptOut(t *testing.T) {
+	cfg := config.Default()
+	queue := delivery.NewQueue(10, func(m delivery.Message) error { return nil })
+	state := &fakeState{routes: routesTo("channel-1")}
+	handler := NewHandler(&cfg, nil, state, queue, health.NewChecker(time.Second))
+
+	if w := postWebhook(handler, reviewWebhook); w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want 401", w.Code)
+	}
+	if len(state.recorded) != 0 {
+		t.Errorf("recorded %d reviews from a refused webhook", len(state.recorded))
+	}
+
+	cfg.AllowUnauthenticatedWebhooks = true
+	if w := postWebhook(handler, reviewWebhook); w.Code != http.StatusOK {
+		t.Errorf("opted out: got status %d, want 200", w.Code)
+	}
+}
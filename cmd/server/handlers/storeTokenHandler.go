@@ -2,19 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/liukaku/discord-tp/cmd/metrics"
 	"github.com/liukaku/discord-tp/cmd/server/handlers/utils"
 	"github.com/liukaku/discord-tp/cmd/server/types"
 )
 
-func StoreTokenHandler(w http.ResponseWriter, r *http.Request, state types.SharedState) {
+func StoreTokenHandler(w http.ResponseWriter, r *http.Request, apiUrl string, state types.SharedState) {
+	apiUrl = strings.TrimSuffix(apiUrl, "/")
 	var tokenData struct {
 		AccessToken string `json:"access_token"`
 		TokenType   string `json:"token_type"`
 		ExpiresIn   string `json:"expires_in"`
+		State       string `json:"state"`
 	}
 
 	// Parse the JSON body
@@ -24,85 +29,88 @@ func StoreTokenHandler(w http.ResponseWriter, r *http.Request, state types.Share
 		return
 	}
 
-	fmt.Println("Received access token:", tokenData.AccessToken)
-	fmt.Println("Token type:", tokenData.TokenType)
-	fmt.Println("Expires in:", tokenData.ExpiresIn)
+	// state was handed out by /login, so it tells us which guild this token is for
+	guildID, ok := state.ConsumeLoginState(tokenData.State)
+	if !ok {
+		http.Error(w, "Login link expired, run /login again", http.StatusBadRequest)
+		return
+	}
+
+	logger := slog.With("guild_id", guildID)
+	logger.InfoContext(r.Context(), "received access token", "token_type", tokenData.TokenType, "expires_in", tokenData.ExpiresIn)
 
-	userInfo, err := getAboutMe(tokenData.AccessToken)
+	userInfo, err := getAboutMe(apiUrl, tokenData.AccessToken)
 
 	if err != nil {
+		logger.ErrorContext(r.Context(), "cannot fetch Trustpilot user", "error", err)
+		metrics.Logins.WithLabelValues(guildID, "failed").Inc()
 		http.Error(w, "Error fetching user info", http.StatusInternalServerError)
 		return
 	}
 
-	businessUnitsInfo, err := getBusinessUnitsInfo(userInfo.BusinessUser.ID, tokenData.AccessToken)
+	expiresIn, err := strconv.Atoi(tokenData.ExpiresIn)
+	if err != nil {
+		logger.WarnContext(r.Context(), "invalid token expiry", "expires_in", tokenData.ExpiresIn)
+		metrics.Logins.WithLabelValues(guildID, "failed").Inc()
+		http.Error(w, "Invalid expires_in", http.StatusBadRequest)
+		return
+	}
+	businessUnitsInfo, err := getBusinessUnitsInfo(apiUrl, userInfo.BusinessUser.ID, tokenData.AccessToken)
 
 	if err != nil {
+		logger.ErrorContext(r.Context(), "cannot fetch business units", "error", err)
+		metrics.Logins.WithLabelValues(guildID, "failed").Inc()
 		http.Error(w, "Error fetching business units info", http.StatusInternalServerError)
 		return
 	}
 
+	// The guild only gets reviews of the business units its account can see
+	var units []types.LinkedBusinessUnit
 	for _, bu := range businessUnitsInfo.BusinessUnits {
-		businessUnitDetails, err := getSingleBusinessUnitInfo(bu.ID, tokenData.AccessToken)
+		businessUnitDetails, err := getSingleBusinessUnitInfo(apiUrl, bu.ID, tokenData.AccessToken)
 
 		if err != nil {
+			logger.ErrorContext(r.Context(), "cannot fetch business unit", "business_unit_id", bu.ID, "error", err)
+			metrics.Logins.WithLabelValues(guildID, "failed").Inc()
 			http.Error(w, "Error fetching single business unit info", http.StatusInternalServerError)
 			return
 		}
 
+		logger.InfoContext(r.Context(), "found business unit", "business_unit_id", businessUnitDetails.ID, "business_unit", businessUnitDetails.DisplayName)
+		units = append(units, types.LinkedBusinessUnit{ID: businessUnitDetails.ID, Name: businessUnitDetails.DisplayName})
 		state.AppendToBuids(businessUnitDetails.DisplayName)
 	}
+
+	state.SetTrustpilotLink(guildID, types.TrustpilotLink{
+		AccessToken:    tokenData.AccessToken,
+		BusinessUserID: userInfo.BusinessUser.ID,
+		ExpiresAt:      time.Now().Add(time.Duration(expiresIn) * time.Second),
+		BusinessUnits:  units,
+	})
+	metrics.Logins.WithLabelValues(guildID, "ok").Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"success": true}`))
 }
 
-func getAboutMe(accessToken string) (*types.UserResponse, error) {
-	response, err := utils.HttpGetRequest("https://api.tp-staging.com/v1/private/me", accessToken)
+func getAboutMe(apiUrl string, accessToken string) (*types.UserResponse, error) {
+	response, err := utils.HttpGetRequest(apiUrl+"/v1/private/me", accessToken)
 	if err != nil {
-		fmt.Println("Error making API request:", err)
 		return nil, err
 	}
 
 	userInfo, err := utils.ProcessUserResponse(response)
 	if err != nil {
-		fmt.Println("Error parsing user info:", err)
 		return nil, err
 	}
 
 	return userInfo, nil
 }
 
-func getBusinessUnitsInfo(businessUserId string, accessToken string) (*types.BusinessUnitsResponse, error) {
-	buidUrl := fmt.Sprintf("https://api.tp-staging.com/v1/private/business-users/%s/business-units", businessUserId)
-	businessUnitsResponse, err := utils.HttpGetRequest(buidUrl, accessToken)
-
-	if err != nil {
-		fmt.Println("Error making business units API request:", err)
-		return nil, err
-	}
-	businessUnitsInfo, err := utils.ProcessBusinessUnitsResponse(businessUnitsResponse)
-	if err != nil {
-		fmt.Println("Error parsing business units info:", err)
-		return nil, err
-	}
-	fmt.Println("Business Units:")
-
-	return businessUnitsInfo, nil
+func getBusinessUnitsInfo(apiUrl string, businessUserId string, accessToken string) (*types.BusinessUnitsResponse, error) {
+	return utils.GetBusinessUnits(apiUrl, businessUserId, accessToken)
 }
 
-func getSingleBusinessUnitInfo(businessUnitId string, accessToken string) (*types.BusinessUnitDetails, error) {
-	buidInfoUrl := fmt.Sprintf("https://api.tp-staging.com/v1/private/business-units/%s", businessUnitId)
-	time.Sleep(500 * time.Millisecond) // Add delay to avoid throttling
-	buInfoResponse, err := utils.HttpGetRequest(buidInfoUrl, accessToken)
-	if err != nil {
-		fmt.Println("Error making business unit info API request:", err)
-		return nil, err
-	}
-
-	businessUnitDetails, err := utils.ProcessBusinessUnitDetails(buInfoResponse)
-	if err != nil {
-		fmt.Println("Error parsing business unit details:", err)
-		return nil, err
-	}
-	fmt.Printf("Business Unit ID: %s\n", businessUnitDetails.ID)
-	fmt.Printf("Business Unit Display Name: %s\n", businessUnitDetails.DisplayName)
-	return businessUnitDetails, nil
+func getSingleBusinessUnitInfo(apiUrl string, businessUnitId string, accessToken string) (*types.BusinessUnitDetails, error) {
+	return utils.GetBusinessUnitDetails(apiUrl, businessUnitId, accessToken)
 }
@@ -1,13 +1,17 @@
 package utils
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/liukaku/discord-tp/cmd/metrics"
 	"github.com/liukaku/discord-tp/cmd/server/types"
 )
 
@@ -21,11 +25,14 @@ func HttpGetRequest(url string, bearer string) (string, error) {
 	}
 
 	client := &http.Client{}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveTrustpilotRequest(http.MethodGet, url, 0, start)
 		return "", fmt.Errorf("error making GET request: %w", err)
 	}
 	defer resp.Body.Close()
+	metrics.ObserveTrustpilotRequest(http.MethodGet, url, resp.StatusCode, start)
 
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
@@ -50,11 +57,14 @@ func HttpPostRequest(url string, bearer string, body string) (string, error) {
 	}
 	req.Header.Set("Content-Type", "application/json")
 	client := &http.Client{}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveTrustpilotRequest(http.MethodPost, url, 0, start)
 		return "", fmt.Errorf("error making POST request: %w", err)
 	}
 	defer resp.Body.Close()
+	metrics.ObserveTrustpilotRequest(http.MethodPost, url, resp.StatusCode, start)
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
 	}
@@ -65,19 +75,44 @@ func HttpPostRequest(url string, bearer string, body string) (string, error) {
 	return string(respBod), nil
 }
 
-func SendReviewReply(reviewId string, userId string, replyMessage string, bearer string) error {
-	url := fmt.Sprintf("https://api.tp-staging.com/v1/private/reviews/%s/reply", reviewId)
-	body := fmt.Sprintf(`{"authorBusinessUnserId": "%s", "message": "%s"}`, userId, replyMessage)
+func SendReviewReply(apiUrl string, reviewId string, userId string, replyMessage string, bearer string) error {
+	url := fmt.Sprintf("%s/v1/private/reviews/%s/reply", strings.TrimSuffix(apiUrl, "/"), reviewId)
+	body, err := json.Marshal(map[string]string{
+		"authorBusinessUserId": userId,
+		"message":              replyMessage,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding review reply: %w", err)
+	}
 
-	resp, err := HttpPostRequest(url, bearer, body)
+	_, err = HttpPostRequest(url, bearer, string(body))
 	if err != nil {
 		return fmt.Errorf("error sending review reply: %w", err)
 	}
-
-	fmt.Println("Review reply response:", resp)
 	return nil
 }
 
+// GetBusinessUnits lists the business units businessUserId can see.
+func GetBusinessUnits(apiUrl string, businessUserId string, bearer string) (*types.BusinessUnitsResponse, error) {
+	url := fmt.Sprintf("%s/v1/private/business-users/%s/business-units", strings.TrimSuffix(apiUrl, "/"), businessUserId)
+	response, err := HttpGetRequest(url, bearer)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessBusinessUnitsResponse(response)
+}
+
+// GetBusinessUnitDetails fetches a business unit, including its score and
+// how many reviews it has of each rating.
+func GetBusinessUnitDetails(apiUrl string, businessUnitId string, bearer string) (*types.BusinessUnitDetails, error) {
+	url := fmt.Sprintf("%s/v1/private/business-units/%s", strings.TrimSuffix(apiUrl, "/"), businessUnitId)
+	response, err := HttpGetRequest(url, bearer)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessBusinessUnitDetails(response)
+}
+
 func ProcessUserResponse(responseBody string) (*types.UserResponse, error) {
 	var userResponse types.UserResponse
 	err := json.Unmarshal([]byte(responseBody), &userResponse)
@@ -108,20 +143,33 @@ func ProcessBusinessUnitDetails(responseBody string) (*types.BusinessUnitDetails
 	return &businessUnitDetails, nil
 }
 
-func ConvertTrustpilotApiUrlToPublic(apiUrl string) string {
+// WebhookUser is the user name in the webhook URL registered with Trustpilot.
+//
+// Trustpilot doesn't sign webhooks. It sends the credentials in the webhook
+// URL as HTTP basic auth, so the URL is registered with the shared secret as
+// its password, like https://trustpilot:<secret>@bot.example.com/trustpilot
+const WebhookUser = "trustpilot"
+
+// VerifyWebhookAuth reports whether r carries secret as its basic auth password.
+func VerifyWebhookAuth(r *http.Request, secret string) bool {
+	_, password, ok := r.BasicAuth()
+	return ok && subtle.ConstantTimeCompare([]byte(password), []byte(secret)) == 1
+}
+
+// ConvertTrustpilotApiUrlToPublic turns a review link from a webhook, which
+// points at webhookOrigin, into the review's page on siteUrl
+func ConvertTrustpilotApiUrlToPublic(apiUrl string, webhookOrigin string, siteUrl string) string {
 	// First, extract the review ID
-	re := regexp.MustCompile(`https://api\.tp-staging\.com/v1/reviews/([a-f0-9]+)`)
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(strings.TrimSuffix(webhookOrigin, "/")) + `/v1/reviews/([a-zA-Z0-9]+)`)
 	matches := re.FindStringSubmatch(apiUrl)
 
 	if len(matches) < 2 {
-		fmt.Println("Warning: Could not extract review ID from URL:", apiUrl)
+		slog.Warn("cannot extract review ID from link", "link", apiUrl)
 		return apiUrl // Return original if no match
 	}
 
-	// reviewId := matches[1]
-
 	// Create the public URL
-	publicUrl := strings.Replace(apiUrl, "api.tp-staging.com/v1", "www.tp-staging.com", 1)
+	publicUrl := strings.TrimSuffix(siteUrl, "/") + "/reviews/" + matches[1]
 
 	return publicUrl
 }
@@ -1,9 +1,14 @@
 package pages
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 // CreateAuthPage returns an HTML page that extracts access token from URL fragment
-// and sends it to the server before redirecting to Discord
-func CreateAuthPage() string {
-	return `
+// and sends it to the server before redirecting to discordAppUrl
+func CreateAuthPage(discordAppUrl string) string {
+	return strings.ReplaceAll(`
 <!DOCTYPE html>
 <html>
 <head>
@@ -92,6 +97,7 @@ func CreateAuthPage() string {
             const accessToken = params['access_token'];
             const tokenType = params['token_type'];
             const expiresIn = params['expires_in'];
+            const loginState = params['state'];
             
             if (!accessToken) {
                 statusEl.textContent = 'Error: No access token found in URL';
@@ -108,7 +114,8 @@ func CreateAuthPage() string {
                 body: JSON.stringify({
                     access_token: accessToken,
                     token_type: tokenType,
-                    expires_in: expiresIn
+                    expires_in: expiresIn,
+                    state: loginState
                 })
             })
             .then(response => {
@@ -125,12 +132,12 @@ func CreateAuthPage() string {
                 // Show redirect button
                 redirectBtn.style.display = 'inline-block';
                 redirectBtn.addEventListener('click', function() {
-                    window.location.href = 'https://discord.com/app';
+                    window.location.href = {{DISCORD_APP_URL}};
                 });
                 
                 // Auto redirect after 5 seconds
                 setTimeout(() => {
-                    window.location.href = 'https://discord.com/app';
+                    window.location.href = {{DISCORD_APP_URL}};
                 }, 5000);
             })
             .catch(error => {
@@ -142,5 +149,11 @@ func CreateAuthPage() string {
     </script>
 </body>
 </html>
-`
+`, "{{DISCORD_APP_URL}}", jsString(discordAppUrl))
+}
+
+// jsString quotes s as a JavaScript string literal
+func jsString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
 }
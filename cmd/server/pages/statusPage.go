@@ -0,0 +1,105 @@
+package pages
+
+import (
+	"html/template"
+	"strings"
+	"time"
+)
+
+// StatusPageData is everything shown on the status page
+type StatusPageData struct {
+	Guilds        []StatusGuild
+	BusinessUnits []string
+	Routes        []StatusRoute
+	LastWebhook   time.Time
+	QueueDepth    int
+	HttpRoutes    []string
+}
+
+// StatusGuild is a guild the bot is connected to
+type StatusGuild struct {
+	ID   string
+	Name string
+}
+
+// StatusRoute is a channel reviews are delivered to
+type StatusRoute struct {
+	ChannelID   string
+	ChannelName string
+	GuildName   string
+	// Filter describes which reviews the channel gets
+	Filter string
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"since": func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+}).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Trustpilot Bot Status</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            margin: 50px;
+            background-color: #36393f;
+            color: #ffffff;
+        }
+        .container {
+            max-width: 800px;
+            margin: 0 auto;
+            padding: 20px;
+            background-color: #2f3136;
+            border-radius: 8px;
+            box-shadow: 0 4px 8px rgba(0, 0, 0, 0.2);
+        }
+        h1, h2 {
+            color: #7289da;
+        }
+        td, th {
+            text-align: left;
+            padding: 4px 12px 4px 0;
+        }
+        .muted {
+            color: #b9bbbe;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Trustpilot Bot Status</h1>
+
+        <h2>Delivery</h2>
+        <table>
+            <tr><th>Last webhook</th><td>{{if .LastWebhook.IsZero}}<span class="muted">none received yet</span>{{else}}{{.LastWebhook.UTC.Format "2006-01-02 15:04:05 MST"}} ({{since .LastWebhook}} ago){{end}}</td></tr>
+            <tr><th>Queued messages</th><td>{{.QueueDepth}}</td></tr>
+        </table>
+
+        <h2>Connected guilds ({{len .Guilds}})</h2>
+        {{if .Guilds}}<ul>{{range .Guilds}}<li>{{.Name}} <span class="muted">{{.ID}}</span></li>{{end}}</ul>{{else}}<p class="muted">Not connected to any guilds</p>{{end}}
+
+        <h2>Linked business units ({{len .BusinessUnits}})</h2>
+        {{if .BusinessUnits}}<ul>{{range .BusinessUnits}}<li>{{.}}</li>{{end}}</ul>{{else}}<p class="muted">No business units linked, use /login</p>{{end}}
+
+        <h2>Review channels ({{len .Routes}})</h2>
+        {{if .Routes}}<table>
+            <tr><th>Channel</th><th>Guild</th><th>Reviews</th></tr>
+            {{range .Routes}}<tr><td>#{{or .ChannelName .ChannelID}}</td><td>{{.GuildName}}</td><td>{{.Filter}}</td></tr>{{end}}
+        </table>{{else}}<p class="muted">No channels configured, use /settings</p>{{end}}
+
+        <h2>HTTP routes</h2>
+        <ul>{{range .HttpRoutes}}<li><code>{{.}}</code></li>{{end}}</ul>
+    </div>
+</body>
+</html>
+`))
+
+// CreateStatusPage renders the read-only status page
+func CreateStatusPage(data StatusPageData) (string, error) {
+	var page strings.Builder
+	err := statusTemplate.Execute(&page, data)
+	if err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
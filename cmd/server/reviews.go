@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/forum"
+	bot "github.com/liukaku/discord-tp/cmd/handlers"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/handlers/utils"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+// reviewFromEvent collects what the embed shows about a webhook's review.
+func reviewFromEvent(data types.ReviewData, cfg *config.Config, businessUnit types.LinkedBusinessUnit) render.Review {
+	review := render.Review{
+		ID:             data.ID,
+		Title:          data.Title,
+		Text:           data.Text,
+		Stars:          data.Stars,
+		Language:       data.Language,
+		Verified:       data.IsVerified,
+		ConsumerName:   data.Consumer.Name,
+		URL:            utils.ConvertTrustpilotApiUrlToPublic(data.Link, cfg.WebhookOrigin, cfg.SiteURL),
+		BusinessUnit:   businessUnit.Name,
+		BusinessUnitID: businessUnit.ID,
+		CreatedAt:      data.CreatedAt,
+	}
+	if data.Consumer.ID != "" {
+		review.ConsumerURL = strings.TrimSuffix(cfg.SiteURL, "/") + "/users/" + data.Consumer.ID
+	}
+	for _, tag := range data.Tags {
+		review.Tags = append(review.Tags, render.Tag{Group: tag.Group, Value: tag.Value})
+	}
+	return review
+}
+
+// reviewMessage is the message posted for a review: its embed, laid out by
+// the guild's template, a button to reply, and pings for mentions.
+func reviewMessage(ctx context.Context, review render.Review, tmpl render.Template, mentions routing.Mentions) *discordgo.MessageSend {
+	embed, err := render.Embed(review, tmpl)
+	if err != nil {
+		// Templates are checked when they're saved, but a review can still
+		// trip one up, and it's better posted plainly than not at all
+		slog.WarnContext(ctx, "embed template failed, using the default", "review_id", review.ID, "error", err)
+		embed, _ = render.Embed(review, render.DefaultTemplate)
+	}
+
+	return &discordgo.MessageSend{
+		Content: mentions.Content(),
+		Embeds:  []*discordgo.MessageEmbed{embed},
+		// Only the configured roles and users are pinged, never anything in the review
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Roles: mentions.RoleIDs,
+			Users: mentions.UserIDs,
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Reply",
+						Style:    discordgo.PrimaryButton,
+						CustomID: bot.CustomID("reply", review.ID),
+					},
+				},
+			},
+		},
+	}
+}
+
+// reviewThreadArchiveMinutes is how long a review's thread or post stays open
+// without messages before Discord archives it
+const reviewThreadArchiveMinutes = 7 * 24 * 60
+
+// reviewThread is the thread to start on review's message in channelID, and
+// a callback that tracks it so it can be resolved when the review is replied to.
+func reviewThread(state types.SharedState, review render.Review, channelID string) (*discordgo.ThreadStart, func(*discordgo.Message, *discordgo.Channel)) {
+	start := &discordgo.ThreadStart{
+		Name:                render.ThreadName(review),
+		AutoArchiveDuration: reviewThreadArchiveMinutes,
+	}
+	return start, trackThread(state, review.ID, types.ReviewThread{ChannelID: channelID, Name: start.Name})
+}
+
+// reviewForumPost is the post review starts in the forum channelID, tagged
+// with its rating and status, escalated if the route's mention rules pick it
+// out, and a callback that tracks it so its status can follow the review's.
+func reviewForumPost(state types.SharedState, review render.Review, channelID string, escalated bool) (*delivery.ForumPost, func(*discordgo.Message, *discordgo.Channel)) {
+	status := forum.StatusOpen
+	if escalated {
+		status = forum.StatusEscalated
+	}
+	post := &delivery.ForumPost{
+		Name:                render.ThreadName(review),
+		AutoArchiveDuration: reviewThreadArchiveMinutes,
+		TagNames:            forum.TagNames(review, status),
+	}
+	return post, trackThread(state, review.ID, types.ReviewThread{ChannelID: channelID, Name: post.Name, Forum: true})
+}
+
+// trackThread returns a callback for delivery that records the thread
+// started on reviewID's message, described by thread.
+func trackThread(state types.SharedState, reviewID string, thread types.ReviewThread) func(*discordgo.Message, *discordgo.Channel) {
+	return func(message *discordgo.Message, started *discordgo.Channel) {
+		if started == nil {
+			return
+		}
+		thread.ThreadID = started.ID
+		thread.CreatedAt = time.Now()
+		state.AddReviewThread(reviewID, thread)
+	}
+}
+
+// channelGuild returns the ID of the guild channelID is in, or "" if the
+// gateway hasn't told us about it.
+func channelGuild(discord *discordgo.Session, channelID string) string {
+	if discord == nil {
+		return ""
+	}
+	channel, err := discord.State.Channel(channelID)
+	if err != nil {
+		return ""
+	}
+	return channel.GuildID
+}
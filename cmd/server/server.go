@@ -4,158 +4,311 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/joho/godotenv"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/health"
+	"github.com/liukaku/discord-tp/cmd/metrics"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
 	"github.com/liukaku/discord-tp/cmd/server/handlers"
 	"github.com/liukaku/discord-tp/cmd/server/handlers/utils"
 	"github.com/liukaku/discord-tp/cmd/server/pages"
 	"github.com/liukaku/discord-tp/cmd/server/types"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func CreateHttpServer(discord *discordgo.Session, state types.SharedState) {
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println("Error loading .env file")
-		panic(err)
+const (
+	// maxBodyBytes caps request bodies; webhooks and tokens are far smaller
+	maxBodyBytes = 1 << 20
+	// handlerTimeout is how long a handler gets before the client is sent a 503
+	handlerTimeout = 10 * time.Second
+)
+
+// CreateHttpServer returns a server for the bot's routes that has not been
+// started yet. Reviews received by webhook are sent through queue.
+func CreateHttpServer(cfg *config.Config, discord *discordgo.Session, state types.SharedState, queue *delivery.Queue, checker *health.Checker) *http.Server {
+	return &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           NewHandler(cfg, discord, state, queue, checker),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      handlerTimeout + 5*time.Second,
+		IdleTimeout:       60 * time.Second,
 	}
+}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+// NewHandler returns a handler serving every route on its own mux, wrapped
+// in request IDs, logging, body size limits and timeouts. Nothing is
+// registered globally, so it can be used as many times as needed.
+func NewHandler(cfg *config.Config, discord *discordgo.Session, state types.SharedState, queue *delivery.Queue, checker *health.Checker) http.Handler {
+	mux := http.NewServeMux()
 
-		fmt.Println("received get request")
-		fmt.Println("basepath URL frag:", r.URL.Fragment)
-		if r.Method != http.MethodGet {
-			fmt.Println("Method received: ", r.Method)
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+	// httpRoutes lists every pattern registered, for the status page
+	var httpRoutes []string
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, handler)
+		httpRoutes = append(httpRoutes, pattern)
+	}
+	// lastWebhook holds the unix nano time the last webhook was received
+	var lastWebhook atomic.Int64
+
+	handle("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		data := pages.StatusPageData{
+			BusinessUnits: state.GetBuids(),
+			Routes:        statusRoutes(discord, state.GetRoutes()),
+			QueueDepth:    queue.Len(),
+			HttpRoutes:    httpRoutes,
+		}
+		if last := lastWebhook.Load(); last != 0 {
+			data.LastWebhook = time.Unix(0, last)
+		}
+		if discord != nil {
+			discord.State.RLock()
+			for _, guild := range discord.State.Guilds {
+				data.Guilds = append(data.Guilds, pages.StatusGuild{ID: guild.ID, Name: guild.Name})
+			}
+			discord.State.RUnlock()
 		}
 
-		guilds, err := discord.UserGuilds(100, "", "", true)
+		htmlPage, err := pages.CreateStatusPage(data)
 		if err != nil {
-			fmt.Println("Error getting guilds:", err)
-			http.Error(w, "Error getting guilds", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "cannot render status page", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, htmlPage)
+	})
 
-		channelIds := state.GetChannelIDs()
-		fmt.Println("Channel IDs:")
-		for i, channelId := range channelIds {
-			fmt.Printf("Channel ID %d: %s\n", i, channelId)
-			discord.ChannelMessageSend(channelId, "iyaaaaaaa from http")
-		}
+	handle("GET /healthz", checker.LiveHandler)
+	handle("GET /readyz", checker.ReadyHandler)
+	handle("GET /metrics", promhttp.Handler().ServeHTTP)
 
-		fmt.Println("Guilds:")
-		for i, guild := range guilds {
-			fmt.Printf("Guild %d: %s (%s)\n", i, guild.Name, guild.ID)
+	// Sends a test message to every review channel, for checking the bot can post
+	handle("POST /admin/test-message", requireAdmin(cfg.AdminToken, func(w http.ResponseWriter, r *http.Request) {
+		routes := state.GetRoutes()
+		for _, route := range routes {
+			err := queue.Enqueue(delivery.Message{ChannelID: route.ChannelID, Send: &discordgo.MessageSend{
+				Content: "Test message from the Trustpilot bot",
+			}})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "cannot queue test message", "channel_id", route.ChannelID, "error", err)
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
 		}
-	})
 
-	http.HandleFunc("/trustpilot", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("received trustpilot request")
-		if r.Method != http.MethodPost {
-			fmt.Println("Method received: ", r.Method)
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"queued": %d}`, len(routes))
+	}))
+
+	handle("POST /trustpilot", func(w http.ResponseWriter, r *http.Request) {
+		if !webhookAuthorised(cfg, r) {
+			slog.WarnContext(r.Context(), "webhook credentials don't match", "client", clientAddr(r))
+			metrics.WebhooksRejected.WithLabelValues("unknown", "unauthorised").Inc()
+			w.Header().Set("WWW-Authenticate", `Basic realm="webhooks"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		lastWebhook.Store(time.Now().UnixNano())
 		// parse out the request body and log it
 		requestBody := r.Body
 		bodyBytes, err := io.ReadAll(requestBody)
 		if err != nil {
-			fmt.Println("Error reading request body:", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			slog.WarnContext(r.Context(), "cannot read webhook body", "error", err)
+			metrics.WebhooksRejected.WithLabelValues("unknown", "unreadable").Inc()
+			bodyReadError(w, err)
 			return
 		}
-		fmt.Println("Request body:", string(bodyBytes))
+		slog.DebugContext(r.Context(), "webhook received", "bytes", len(bodyBytes))
 
 		var trustpilotRequest types.ReviewCreated
 		err = json.Unmarshal(bodyBytes, &trustpilotRequest)
 		if err != nil {
-			fmt.Println("Error parsing request body:", err)
+			slog.WarnContext(r.Context(), "cannot parse webhook body", "error", err)
+			metrics.WebhooksRejected.WithLabelValues("unknown", "invalid").Inc()
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if len(trustpilotRequest.Events) == 0 {
+			metrics.WebhooksRejected.WithLabelValues("unknown", "empty").Inc()
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		fmt.Println("Parsed Trustpilot request:", len(trustpilotRequest.Events))
-		ids := state.GetChannelIDs()
-		for n := range ids {
-			starString := ""
-			for range trustpilotRequest.Events[0].EventData.Stars {
-				starString += "⭐"
+		businessUnit, ok := webhookBusinessUnit(r, state.GetBusinessUnits())
+		if !ok {
+			// Kept in the history, but no guild is known to want it
+			slog.WarnContext(r.Context(), "webhook is for an unknown business unit, add ?business_unit=<id> to its URL", "business_unit", r.URL.Query().Get("business_unit"))
+		}
+
+		// Nothing is queued or recorded until every message can be queued, so
+		// Trustpilot retrying a webhook that was refused doesn't post twice
+		var messages []delivery.Message
+		var reviews []render.Review
+		var replied []string
+		type digestReview struct {
+			channelID string
+			review    render.Review
+		}
+		var digestReviews []digestReview
+
+		routes := state.GetRoutes()
+		for _, event := range trustpilotRequest.Events {
+			metrics.WebhooksReceived.WithLabelValues(eventLabel(event.EventName)).Inc()
+			if event.EventName == types.ReviewReplyEvent {
+				replied = append(replied, event.EventData.ID)
+				// However the review was replied to, its threads are resolved
+				messages = append(messages, delivery.ResolveThreads(state, event.EventData.ID)...)
+				continue
 			}
+			slog.InfoContext(r.Context(), "review received",
+				"event", event.EventName,
+				"review_id", event.EventData.ID,
+				"stars", event.EventData.Stars,
+				"consumer_name", event.EventData.Consumer.Name)
 
-			link := utils.ConvertTrustpilotApiUrlToPublic(trustpilotRequest.Events[0].EventData.Link)
-
-			_, err := discord.ChannelMessageSendComplex(ids[n], &discordgo.MessageSend{
-				Content: fmt.Sprintf("New Trustpilot review received:\n**%s**\n%s\nRating: %s\nLink: %s",
-					trustpilotRequest.Events[0].EventData.Consumer.Name,
-					trustpilotRequest.Events[0].EventData.Text,
-					starString,
-					link,
-				),
-				Embeds: []*discordgo.MessageEmbed{
-					{
-						Title:       "Trustpilot Review",
-						Description: trustpilotRequest.Events[0].EventData.Text,
-						URL:         link,
-						Color:       0x00ff00, // Green color
-						Fields: []*discordgo.MessageEmbedField{
-							{
-								Name:   "Author",
-								Value:  trustpilotRequest.Events[0].EventData.Consumer.Name,
-								Inline: true,
-							},
-						},
-						// Thumbnail: &discordgo.MessageEmbedThumbnail{
-						// 	URL: trustpilotRequest.Events[0].EventData.Consumer.Image,
-						// },
-					},
-				},
-			})
-			if err != nil {
-				fmt.Println("Error sending message:", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
+			review := reviewFromEvent(event.EventData, cfg, businessUnit)
+			reviews = append(reviews, review)
+			for _, route := range routes {
+				if !route.Matches(review) {
+					slog.DebugContext(r.Context(), "review filtered out", "channel_id", route.ChannelID, "review_id", review.ID)
+					continue
+				}
+				if !route.Digest.IsZero() {
+					digestReviews = append(digestReviews, digestReview{route.ChannelID, review})
+					if route.Digest.Only {
+						continue
+					}
+				}
+				guildID := route.GuildID
+				if guildID == "" {
+					guildID = channelGuild(discord, route.ChannelID)
+				}
+				mentions := route.Mentions(review, time.Now())
+				message := delivery.Message{
+					ChannelID: route.ChannelID,
+					Send:      reviewMessage(r.Context(), review, state.GetEmbedTemplate(guildID), mentions),
+				}
+				switch {
+				case route.Forum:
+					message.ForumPost, message.Sent = reviewForumPost(state, review, route.ChannelID, route.Escalates(review))
+				case route.Threads:
+					message.Thread, message.Sent = reviewThread(state, review, route.ChannelID)
+				}
+				messages = append(messages, message)
 			}
-			discord.ChannelMessageSend(ids[n], fmt.Sprintf("New Trustpilot review received: %s", trustpilotRequest.Events[0].EventData.Text))
+		}
 
+		if err := queue.EnqueueAll(messages); err != nil {
+			slog.ErrorContext(r.Context(), "cannot queue reviews", "messages", len(messages), "error", err)
+			for _, event := range trustpilotRequest.Events {
+				metrics.WebhooksRejected.WithLabelValues(eventLabel(event.EventName), "queue_full").Inc()
+			}
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		for _, review := range reviews {
+			state.RecordReview(review)
+		}
+		for _, reviewID := range replied {
+			slog.InfoContext(r.Context(), "review replied to", "review_id", reviewID)
+			state.MarkReviewReplied(reviewID)
+		}
+		for _, buffered := range digestReviews {
+			state.BufferDigestReview(buffered.channelID, buffered.review)
 		}
 	})
 
 	// /auth#access_token=tpa-f15f4140ae0a487b86be547fd76f&token_type=bearer&expires_in=360000
-	http.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("received auth request")
-		fmt.Println("Query parameters:", r.URL.Query())
-		if r.Method != http.MethodGet {
-			fmt.Println("Method received: ", r.Method)
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	handle("GET /auth", func(w http.ResponseWriter, r *http.Request) {
 		// Serve the HTML page that extracts access token from URL fragment
-		htmlPage := pages.CreateAuthPage()
+		htmlPage := pages.CreateAuthPage(cfg.DiscordAppURL)
 		w.Header().Set("Content-Type", "text/html")
 		_, err := io.WriteString(w, htmlPage)
 		if err != nil {
-			fmt.Println("Error writing HTML page:", err)
+			slog.ErrorContext(r.Context(), "cannot write auth page", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
 
-	http.HandleFunc("/store-token", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+	handle("POST /store-token", func(w http.ResponseWriter, r *http.Request) {
+		handlers.StoreTokenHandler(w, r, cfg.APIURL, state)
+	})
+
+	return withMiddleware(mux)
+}
+
+// webhookBusinessUnit works out which of units a webhook's reviews are for.
+// Trustpilot doesn't say, so the webhook URL names it by ID or name in
+// ?business_unit=; with only one unit linked there's no doubt.
+func webhookBusinessUnit(r *http.Request, units []types.LinkedBusinessUnit) (types.LinkedBusinessUnit, bool) {
+	wanted := r.URL.Query().Get("business_unit")
+	if wanted == "" {
+		if len(units) == 1 {
+			return units[0], true
 		}
+		return types.LinkedBusinessUnit{}, false
+	}
+	if unit, ok := types.FindBusinessUnit(units, wanted); ok {
+		return unit, true
+	}
+	return types.LinkedBusinessUnit{Name: wanted}, false
+}
 
-		handlers.StoreTokenHandler(w, r, state)
+// webhookAuthorised reports whether a webhook carries the webhook secret,
+// or whether webhooks from anyone are allowed without one.
+func webhookAuthorised(cfg *config.Config, r *http.Request) bool {
+	if cfg.WebhookSecret == "" {
+		return cfg.AllowUnauthenticatedWebhooks
+	}
+	return utils.VerifyWebhookAuth(r, cfg.WebhookSecret)
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"success": true}`))
-	})
+// eventLabel is the metric label for a webhook event. Anyone can post a
+// webhook, so names we don't know are all counted as other.
+func eventLabel(name string) string {
+	switch name {
+	case types.ReviewCreatedEvent, types.ReviewReplyEvent:
+		return name
+	default:
+		return "other"
+	}
+}
+
+// withMiddleware wraps the mux in everything every request goes through.
+func withMiddleware(mux *http.ServeMux) http.Handler {
+	var handler http.Handler = mux
+	handler = http.TimeoutHandler(handler, handlerTimeout, "Request timed out")
+	handler = withBodyLimit(handler, maxBodyBytes)
+	handler = withLogging(handler)
+	handler = withRequestID(handler)
+	return handler
+}
 
-	err = http.ListenAndServe(":8080", nil)
-	if err != nil {
-		fmt.Println(err)
+// statusRoutes describes the review channels, naming them from the gateway's
+// cache where possible.
+func statusRoutes(discord *discordgo.Session, routes []routing.Route) []pages.StatusRoute {
+	result := make([]pages.StatusRoute, len(routes))
+	for n, route := range routes {
+		result[n] = pages.StatusRoute{ChannelID: route.ChannelID, Filter: route.Filter.String()}
+		if discord == nil {
+			continue
+		}
+		if channel, err := discord.State.Channel(route.ChannelID); err == nil {
+			result[n].ChannelName = channel.Name
+			if guild, err := discord.State.Guild(channel.GuildID); err == nil {
+				result[n].GuildName = guild.Name
+			}
+		}
 	}
+	return result
 }
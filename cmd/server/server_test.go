@@ -0,0 +1,533 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/config"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/discordtest"
+	"github.com/liukaku/discord-tp/cmd/health"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// fakeState is an in-memory SharedState.
+type fakeState struct {
+	sync.Mutex
+	routes      []routing.Route
+	recorded    []render.Review
+	threads     map[string][]types.ReviewThread
+	digests     map[string][]render.Review
+	replied     []string
+	buids       []string
+	loginStates map[string]string
+	links       map[string]types.TrustpilotLink
+	// units are the linked business units, testBusinessUnit if nil and
+	// no guild is linked
+	units    []types.LinkedBusinessUnit
+	template render.Template
+}
+
+// testBusinessUnit is the business unit trustpilottest serves.
+var testBusinessUnit = types.LinkedBusinessUnit{ID: "business-unit-1", Name: "Acme"}
+
+// routesTo returns unfiltered routes of testBusinessUnit to channelIDs.
+func routesTo(channelIDs ...string) []routing.Route {
+	routes := make([]routing.Route, len(channelIDs))
+	for n, channelID := range channelIDs {
+		routes[n] = routing.Route{ChannelID: channelID, BusinessUnitID: testBusinessUnit.ID}
+	}
+	return routes
+}
+
+func (f *fakeState) GetRoutes() []routing.Route { return f.routes }
+
+func (f *fakeState) RecordReview(review render.Review) {
+	f.Lock()
+	defer f.Unlock()
+	f.recorded = append(f.recorded, review)
+}
+
+func (f *fakeState) GetBuids() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string{}, f.buids...)
+}
+
+func (f *fakeState) AppendToBuids(values ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.buids = append(f.buids, values...)
+}
+
+func (f *fakeState) GetBusinessUnits() []types.LinkedBusinessUnit {
+	f.Lock()
+	defer f.Unlock()
+	if f.units != nil {
+		return f.units
+	}
+	var units []types.LinkedBusinessUnit
+	for _, link := range f.links {
+		units = append(units, link.BusinessUnits...)
+	}
+	if len(units) == 0 {
+		return []types.LinkedBusinessUnit{testBusinessUnit}
+	}
+	return units
+}
+
+func (f *fakeState) ConsumeLoginState(loginState string) (string, bool) {
+	f.Lock()
+	defer f.Unlock()
+	guildID, ok := f.loginStates[loginState]
+	delete(f.loginStates, loginState)
+	return guildID, ok
+}
+
+func (f *fakeState) GetEmbedTemplate(guildID string) render.Template { return f.template }
+
+func (f *fakeState) AddReviewThread(reviewID string, thread types.ReviewThread) {
+	f.Lock()
+	defer f.Unlock()
+	if f.threads == nil {
+		f.threads = map[string][]types.ReviewThread{}
+	}
+	f.threads[reviewID] = append(f.threads[reviewID], thread)
+}
+
+func (f *fakeState) GetReviewThreads(reviewID string) []types.ReviewThread {
+	f.Lock()
+	defer f.Unlock()
+	return append([]types.ReviewThread{}, f.threads[reviewID]...)
+}
+
+func (f *fakeState) RemoveReviewThread(reviewID string, threadID string) {
+	f.Lock()
+	defer f.Unlock()
+	f.threads[reviewID] = slices.DeleteFunc(f.threads[reviewID], func(thread types.ReviewThread) bool {
+		return thread.ThreadID == threadID
+	})
+}
+
+func (f *fakeState) BufferDigestReview(channelID string, review render.Review) {
+	f.Lock()
+	defer f.Unlock()
+	if f.digests == nil {
+		f.digests = map[string][]render.Review{}
+	}
+	f.digests[channelID] = append(f.digests[channelID], review)
+}
+
+func (f *fakeState) MarkReviewReplied(reviewID string) {
+	f.Lock()
+	defer f.Unlock()
+	f.replied = append(f.replied, reviewID)
+}
+
+func (f *fakeState) SetTrustpilotLink(guildID string, link types.TrustpilotLink) {
+	f.Lock()
+	defer f.Unlock()
+	if f.links == nil {
+		f.links = map[string]types.TrustpilotLink{}
+	}
+	f.links[guildID] = link
+}
+
+const reviewWebhook = `{"events": [{"eventName": "service-review-created", "eventData": {
+	"id": "review-1",
+	"language": "en",
+	"title": "Great",
+	"text": "Lovely service",
+	"stars": 5,
+	"isVerified": true,
+	"link": "https://api.example.com/v1/reviews/review1",
+	"consumer": {"id": "consumer-1", "name": "Jane"}
+}}]}`
+
+// webhookServer returns a handler whose queue delivers to a fake session,
+// and a function that waits for everything queued to be sent.
+func webhookServer(t *testing.T, channelIDs ...string) (http.Handler, *discordtest.Session, func()) {
+	t.Helper()
+	return webhookServerFor(t, &fakeState{routes: routesTo(channelIDs...)})
+}
+
+// webhookServerFor is webhookServer with the given state.
+func webhookServerFor(t *testing.T, state *fakeState) (http.Handler, *discordtest.Session, func()) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.AllowUnauthenticatedWebhooks = true
+	cfg.WebhookOrigin = "https://api.example.com"
+	cfg.SiteURL = "https://www.example.com"
+
+	session := discordtest.NewSession()
+	queue := delivery.NewQueue(10, func(m delivery.Message) error {
+		return delivery.Deliver(session, m)
+	})
+	queue.Start(context.Background())
+	drain := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := queue.Drain(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := NewHandler(&cfg, nil, state, queue, health.NewChecker(time.Second))
+	return handler, session, drain
+}
+
+func postWebhook(handler http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/trustpilot", strings.NewReader(body)))
+	return w
+}
+
+func TestWebhookSendsOnlyToItsBusinessUnitsRoutes(t *testing.T) {
+	state := &fakeState{
+		routes: []routing.Route{
+			{ChannelID: "acme", BusinessUnitID: testBusinessUnit.ID},
+			{ChannelID: "beta", BusinessUnitID: "business-unit-2"},
+			{ChannelID: "unassigned"},
+		},
+		units: []types.LinkedBusinessUnit{testBusinessUnit, {ID: "business-unit-2", Name: "Beta"}},
+	}
+	handler, session, drain := webhookServerFor(t, state)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/trustpilot?business_unit=beta", strings.NewReader(reviewWebhook)))
+	drain()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	sends := session.Sends()
+	if len(sends) != 1 || sends[0].ChannelID != "beta" {
+		t.Errorf("got sends %+v, want one to beta", sends)
+	}
+	if len(state.recorded) != 1 || state.recorded[0].BusinessUnitID != "business-unit-2" {
+		t.Errorf("recorded %+v", state.recorded)
+	}
+}
+
+func TestWebhookSendsReviewToEveryChannel(t *testing.T) {
+	handler, session, drain := webhookServer(t, "channel-1", "channel-2")
+
+	w := postWebhook(handler, reviewWebhook)
+	drain()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get(RequestIDHeader) == "" {
+		t.Error("response has no request ID")
+	}
+
+	sentTo := map[string]int{}
+	for _, send := range session.Sends() {
+		sentTo[send.ChannelID]++
+		if len(send.Message.Embeds) != 1 || send.Message.Content != "" {
+			t.Fatalf("got %d embeds and content %q, want a single embed", len(send.Message.Embeds), send.Message.Content)
+		}
+		embed := send.Message.Embeds[0]
+		if embed.URL != "https://www.example.com/reviews/review1" {
+			t.Errorf("got review link %q", embed.URL)
+		}
+		if !strings.Contains(embed.Description, "Lovely service") {
+			t.Errorf("got description %q", embed.Description)
+		}
+		if len(send.Message.Components) == 0 {
+			t.Error("review has no reply button")
+		}
+	}
+	if sentTo["channel-1"] != 1 || sentTo["channel-2"] != 1 {
+		t.Errorf("got messages per channel %v, want one in each", sentTo)
+	}
+}
+
+func TestWebhookUsesGuildTemplate(t *testing.T) {
+	cfg := config.Default()
+	cfg.AllowUnauthenticatedWebhooks = true
+	session := discordtest.NewSession()
+	queue := delivery.NewQueue(10, func(m delivery.Message) error {
+		return delivery.Deliver(session, m)
+	})
+	queue.Start(context.Background())
+	state := &fakeState{routes: routesTo("channel-1"), template: render.Template{Title: "{{.Stars}} from {{.ConsumerName}}"}}
+	handler := NewHandler(&cfg, nil, state, queue, health.NewChecker(time.Second))
+
+	postWebhook(handler, reviewWebhook)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	queue.Drain(ctx)
+
+	sends := session.Sends()
+	if len(sends) != 1 || sends[0].Message.Embeds[0].Title != "5 from Jane" {
+		t.Errorf("got %+v", sends)
+	}
+}
+
+func TestWebhookRejectsBadPayloads(t *testing.T) {
+	for name, body := range map[string]string{
+		"invalid JSON": `{"events": [`,
+		"no events":    `{"events": []}`,
+	} {
+		handler, session, drain := webhookServer(t, "channel-1")
+		w := postWebhook(handler, body)
+		drain()
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", name, w.Code)
+		}
+		if sends := session.Sends(); len(sends) != 0 {
+			t.Errorf("%s: sent %d messages", name, len(sends))
+		}
+	}
+}
+
+func TestWebhookReportsFullQueue(t *testing.T) {
+	cfg := config.Default()
+	cfg.AllowUnauthenticatedWebhooks = true
+	// Never started, so nothing takes messages off the queue
+	queue := delivery.NewQueue(1, func(m delivery.Message) error { return nil })
+	state := &fakeState{routes: routesTo("channel-1", "channel-2")}
+	handler := NewHandler(&cfg, nil, state, queue, health.NewChecker(time.Second))
+
+	if w := postWebhook(handler, reviewWebhook); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+	// Trustpilot retries, so none of the review is kept the first time
+	if queue.Len() != 0 || len(state.recorded) != 0 {
+		t.Errorf("queued %d messages and recorded %d reviews, want none", queue.Len(), len(state.recorded))
+	}
+}
+
+func TestEventLabelLimitsUnknownEvents(t *testing.T) {
+	for name, want := range map[string]string{
+		types.ReviewCreatedEvent: types.ReviewCreatedEvent,
+		types.ReviewReplyEvent:   types.ReviewReplyEvent,
+		"made-up-event-1234":     "other",
+		"":                       "other",
+	} {
+		if got := eventLabel(name); got != want {
+			t.Errorf("eventLabel(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWebhookRoutesByFilter(t *testing.T) {
+	state := &fakeState{routes: []routing.Route{
+		{ChannelID: "everything", BusinessUnitID: testBusinessUnit.ID},
+		{ChannelID: "escalations", BusinessUnitID: testBusinessUnit.ID, Filter: routing.Filter{MaxStars: 2}},
+	}}
+	handler, session, drain := webhookServerFor(t, state)
+
+	body := strings.Replace(reviewWebhook, `"stars": 5`, `"stars": 1`, 1)
+	postWebhook(handler, reviewWebhook)
+	postWebhook(handler, body)
+	drain()
+
+	sentTo := map[string]int{}
+	for _, send := range session.Sends() {
+		sentTo[send.ChannelID]++
+	}
+	if sentTo["everything"] != 2 || sentTo["escalations"] != 1 {
+		t.Errorf("got messages per channel %v, want both in everything and the 1★ in escalations", sentTo)
+	}
+	if len(state.recorded) != 2 {
+		t.Errorf("recorded %d reviews, want 2", len(state.recorded))
+	}
+}
+
+func TestWebhookPingsOnlyConfiguredMentions(t *testing.T) {
+	state := &fakeState{routes: []routing.Route{{
+		ChannelID:      "channel-1",
+		BusinessUnitID: testBusinessUnit.ID,
+		MentionRules:   []routing.MentionRule{{Filter: routing.Filter{MaxStars: 2}, RoleIDs: []string{"support"}}},
+	}}}
+	handler, session, drain := webhookServerFor(t, state)
+
+	// The consumer's own @everyone must never ping
+	low := strings.Replace(reviewWebhook, `"stars": 5`, `"stars": 1`, 1)
+	low = strings.Replace(low, "Lovely service", "@everyone look", 1)
+	postWebhook(handler, reviewWebhook)
+	postWebhook(handler, low)
+	drain()
+
+	sends := session.Sends()
+	if len(sends) != 2 {
+		t.Fatalf("got %d messages, want 2", len(sends))
+	}
+	for _, send := range sends {
+		allowed := send.Message.AllowedMentions
+		if allowed == nil || len(allowed.Parse) != 0 || len(allowed.Users) != 0 {
+			t.Fatalf("allowed mentions %+v", allowed)
+		}
+		switch send.Message.Embeds[0].Color {
+		case render.Review{Stars: 1}.Colour():
+			if send.Message.Content != "<@&support>" || len(allowed.Roles) != 1 || allowed.Roles[0] != "support" {
+				t.Errorf("1★ review has content %q and allowed roles %v", send.Message.Content, allowed.Roles)
+			}
+		default:
+			if send.Message.Content != "" || len(allowed.Roles) != 0 {
+				t.Errorf("5★ review pings with %q", send.Message.Content)
+			}
+		}
+	}
+}
+
+func TestWebhookBuffersDigestReviews(t *testing.T) {
+	state := &fakeState{routes: []routing.Route{
+		{ChannelID: "summary", BusinessUnitID: testBusinessUnit.ID, Digest: routing.Digest{Schedule: "daily", Only: true}},
+		{ChannelID: "both", BusinessUnitID: testBusinessUnit.ID, Digest: routing.Digest{Schedule: "weekly"}},
+		{ChannelID: "filtered", BusinessUnitID: testBusinessUnit.ID, Filter: routing.Filter{MaxStars: 2}, Digest: routing.Digest{Schedule: "daily"}},
+	}}
+	handler, session, drain := webhookServerFor(t, state)
+
+	postWebhook(handler, reviewWebhook)
+	drain()
+
+	sends := session.Sends()
+	if len(sends) != 1 || sends[0].ChannelID != "both" {
+		t.Errorf("got %d messages, want one to the channel not in digest-only mode", len(sends))
+	}
+	if len(state.digests["summary"]) != 1 || len(state.digests["both"]) != 1 {
+		t.Errorf("buffered %v", state.digests)
+	}
+	if len(state.digests["filtered"]) != 0 {
+		t.Errorf("buffered a review the route filters out")
+	}
+}
+
+func TestWebhookMarksRepliedReviews(t *testing.T) {
+	state := &fakeState{routes: routesTo("channel-1")}
+	handler, session, drain := webhookServerFor(t, state)
+
+	postWebhook(handler, strings.Replace(reviewWebhook, "service-review-created", types.ReviewReplyEvent, 1))
+	drain()
+
+	if len(state.replied) != 1 || state.replied[0] != "review-1" {
+		t.Errorf("marked %v as replied", state.replied)
+	}
+	if len(state.recorded) != 0 || len(session.Sends()) != 0 {
+		t.Errorf("a reply was treated as a new review")
+	}
+}
+
+func TestWebhookReplyResolvesThreads(t *testing.T) {
+	state := &fakeState{
+		routes: routesTo("triage"),
+		threads: map[string][]types.ReviewThread{"review-1": {
+			{ChannelID: "triage", ThreadID: "post-1", Forum: true},
+			{ChannelID: "discussed", ThreadID: "thread-1", Name: "1★ · Jane · Late"},
+		}},
+	}
+	handler, session, drain := webhookServerFor(t, state)
+	session.AddChannel(&discordgo.Channel{ID: "triage", Type: discordgo.ChannelTypeGuildForum, AvailableTags: []discordgo.ForumTag{
+		{ID: "open", Name: "Open"}, {ID: "replied", Name: "Replied"}, {ID: "one", Name: "1★"},
+	}})
+	session.AddChannel(&discordgo.Channel{ID: "post-1", ParentID: "triage", AppliedTags: []string{"open", "one"}})
+
+	postWebhook(handler, strings.Replace(reviewWebhook, "service-review-created", types.ReviewReplyEvent, 1))
+	drain()
+
+	edits := map[string]*discordgo.ChannelEdit{}
+	for _, edit := range session.Edits() {
+		edits[edit.ChannelID] = edit.Edit
+	}
+	if post := edits["post-1"]; post == nil || post.AppliedTags == nil || !reflect.DeepEqual(*post.AppliedTags, []string{"replied", "one"}) || post.Archived == nil || !*post.Archived {
+		t.Errorf("got forum post edit %+v", post)
+	}
+	if thread := edits["thread-1"]; thread == nil || thread.Name != "✅ Resolved · 1★ · Jane · Late" {
+		t.Errorf("got thread edit %+v", thread)
+	}
+	if tracked := state.threads["review-1"]; len(tracked) != 0 {
+		t.Errorf("still tracking %+v", tracked)
+	}
+}
+
+func TestWebhookStartsReviewThreads(t *testing.T) {
+	state := &fakeState{routes: []routing.Route{
+		{ChannelID: "discussed", BusinessUnitID: testBusinessUnit.ID, Threads: true},
+		{ChannelID: "plain"},
+	}}
+	handler, session, drain := webhookServerFor(t, state)
+
+	postWebhook(handler, reviewWebhook)
+	drain()
+
+	threads := session.Threads()
+	if len(threads) != 1 || threads[0].ChannelID != "discussed" {
+		t.Fatalf("got threads %+v, want one in the discussed channel", threads)
+	}
+	if name := threads[0].Start.Name; name != "5★ · Jane · Great" {
+		t.Errorf("got thread name %q", name)
+	}
+	tracked := state.threads["review-1"]
+	if len(tracked) != 1 || tracked[0].ThreadID != threads[0].ID || tracked[0].ChannelID != "discussed" {
+		t.Errorf("tracking %+v", tracked)
+	}
+}
+
+func TestWebhookPostsToForums(t *testing.T) {
+	state := &fakeState{routes: []routing.Route{{
+		ChannelID:      "triage",
+		BusinessUnitID: testBusinessUnit.ID,
+		Forum:          true,
+		MentionRules:   []routing.MentionRule{{Filter: routing.Filter{MaxStars: 2}, RoleIDs: []string{"support"}}},
+		// Always quiet, which stops the ping but not the escalation
+		QuietHours: routing.QuietHours{Start: "00:00", End: "00:00"},
+	}}}
+	handler, session, drain := webhookServerFor(t, state)
+	session.AddChannel(&discordgo.Channel{ID: "triage", Type: discordgo.ChannelTypeGuildForum, AvailableTags: []discordgo.ForumTag{
+		{ID: "open", Name: "Open"}, {ID: "escalated", Name: "Escalated"}, {ID: "one", Name: "1★"}, {ID: "five", Name: "5★"},
+	}})
+
+	postWebhook(handler, reviewWebhook)
+	postWebhook(handler, strings.Replace(strings.Replace(reviewWebhook, `"stars": 5`, `"stars": 1`, 1), "review-1", "review-2", 1))
+	drain()
+
+	if sends := session.Sends(); len(sends) != 0 {
+		t.Errorf("sent %d channel messages to a forum", len(sends))
+	}
+	posts := session.Threads()
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts, want 2", len(posts))
+	}
+	tags := map[string][]string{}
+	for _, post := range posts {
+		if post.Message == nil || len(post.Message.Embeds) != 1 {
+			t.Fatalf("post %q has no review embed", post.Start.Name)
+		}
+		tags[post.Start.Name] = post.Start.AppliedTags
+		if post.Message.Content != "" {
+			t.Errorf("pinged %q during quiet hours", post.Message.Content)
+		}
+	}
+	if got := tags["5★ · Jane · Great"]; !reflect.DeepEqual(got, []string{"open", "five"}) {
+		t.Errorf("5★ post tagged %v", got)
+	}
+	if got := tags["1★ · Jane · Great"]; !reflect.DeepEqual(got, []string{"escalated", "one"}) {
+		t.Errorf("escalated 1★ post tagged %v", got)
+	}
+	if tracked := state.threads["review-2"]; len(tracked) != 1 || !tracked[0].Forum {
+		t.Errorf("tracking %+v", tracked)
+	}
+}
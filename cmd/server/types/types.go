@@ -1,11 +1,67 @@
 package types
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+)
 
 // Update the shared state interface
 type SharedState interface {
-	GetChannelIDs() []string
+	GetRoutes() []routing.Route
+	RecordReview(review render.Review)
+	GetBuids() []string
 	AppendToBuids(values ...string)
+	// GetBusinessUnits returns every business unit linked in any guild
+	GetBusinessUnits() []LinkedBusinessUnit
+	ConsumeLoginState(loginState string) (string, bool)
+	SetTrustpilotLink(guildID string, link TrustpilotLink)
+	GetEmbedTemplate(guildID string) render.Template
+	AddReviewThread(reviewID string, thread ReviewThread)
+	GetReviewThreads(reviewID string) []ReviewThread
+	RemoveReviewThread(reviewID string, threadID string)
+	BufferDigestReview(channelID string, review render.Review)
+	MarkReviewReplied(reviewID string)
+}
+
+// TrustpilotLink represents the Trustpilot account a guild logged in with
+type TrustpilotLink struct {
+	// AccessToken is saved apart from the rest of the state
+	AccessToken    string `json:",omitempty"`
+	BusinessUserID string
+	ExpiresAt      time.Time
+	// BusinessUnits are the business units the account can see, which are
+	// the only ones the guild gets reviews for
+	BusinessUnits []LinkedBusinessUnit
+}
+
+// LinkedBusinessUnit represents a business unit a guild linked with /login
+type LinkedBusinessUnit struct {
+	ID   string
+	Name string
+}
+
+// FindBusinessUnit looks up the unit among units whose ID or name, ignoring
+// case, is wanted.
+func FindBusinessUnit(units []LinkedBusinessUnit, wanted string) (LinkedBusinessUnit, bool) {
+	for _, unit := range units {
+		if unit.ID == wanted || strings.EqualFold(unit.Name, wanted) {
+			return unit, true
+		}
+	}
+	return LinkedBusinessUnit{}, false
+}
+
+// ReviewThread represents a discussion thread started on a posted review
+type ReviewThread struct {
+	ChannelID string
+	ThreadID  string
+	Name      string
+	// Forum threads are posts in a forum channel, tagged with their status
+	Forum     bool
+	CreatedAt time.Time
 }
 
 // UserResponse represents the top-level response structure
@@ -117,30 +173,44 @@ type Address struct {
 	Street      *string `json:"street"`
 }
 
+// ReviewCreated is the body of a Trustpilot review webhook
 type ReviewCreated struct {
-	Events []struct {
-		EventName string `json:"eventName"`
-		Version   string `json:"version"`
-		EventData struct {
-			ID          string    `json:"id"`
-			Language    string    `json:"language"`
-			Title       string    `json:"title"`
-			Text        string    `json:"text"`
-			ReferenceID string    `json:"referenceId"`
-			Stars       int       `json:"stars"`
-			CreatedAt   time.Time `json:"createdAt"`
-			IsVerified  bool      `json:"isVerified"`
-			LocationID  string    `json:"locationId"`
-			Link        string    `json:"link"`
-			Consumer    struct {
-				ID   string `json:"id"`
-				Name string `json:"name"`
-				Link string `json:"link"`
-			} `json:"consumer"`
-			Tags []struct {
-				Group string `json:"group"`
-				Value string `json:"value"`
-			} `json:"tags"`
-		} `json:"eventData"`
-	} `json:"events"`
+	Events []ReviewEvent `json:"events"`
+}
+
+// ReviewCreatedEvent is the event sent when a consumer writes a review
+const ReviewCreatedEvent = "service-review-created"
+
+// ReviewReplyEvent is the event sent when the business replies to a review,
+// whether on Trustpilot or through the bot. Its data is the review replied to.
+const ReviewReplyEvent = "service-review-reply-created"
+
+// ReviewEvent is a single event in a review webhook
+type ReviewEvent struct {
+	EventName string     `json:"eventName"`
+	Version   string     `json:"version"`
+	EventData ReviewData `json:"eventData"`
+}
+
+// ReviewData is the review an event is about
+type ReviewData struct {
+	ID          string    `json:"id"`
+	Language    string    `json:"language"`
+	Title       string    `json:"title"`
+	Text        string    `json:"text"`
+	ReferenceID string    `json:"referenceId"`
+	Stars       int       `json:"stars"`
+	CreatedAt   time.Time `json:"createdAt"`
+	IsVerified  bool      `json:"isVerified"`
+	LocationID  string    `json:"locationId"`
+	Link        string    `json:"link"`
+	Consumer    struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Link string `json:"link"`
+	} `json:"consumer"`
+	Tags []struct {
+		Group string `json:"group"`
+		Value string `json:"value"`
+	} `json:"tags"`
 }
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/digest"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+	"github.com/liukaku/discord-tp/cmd/storage"
+)
+
+// Create a struct to hold our shared state with a mutex
+type SharedState struct {
+	sync.RWMutex
+	// store keeps the state between restarts, nil keeps it in memory only
+	store *storage.Store
+	// dirty is whether the state has changed since it was last saved
+	dirty bool
+	// history is every review received, saved in a document of its own
+	history  *history.Store
+	StateArr []string
+	// ChannelIDs is where reviews went before routes, kept to read old saves
+	ChannelIDs []string `json:",omitempty"`
+	// Routes are the channels reviews are delivered to and their filters
+	Routes        []routing.Route
+	BusinessUnits []string
+	// RecentReviews maps a business unit ID to its latest reviews, newest
+	// last, for previewing filters
+	RecentReviews map[string][]render.Review `json:"RecentReviewsByBusinessUnit"`
+	// AllowedRoles maps a guild ID to the roles that may run configuration commands
+	AllowedRoles map[string][]string
+	// TrustpilotLinks maps a guild ID to the Trustpilot account it logged in with
+	TrustpilotLinks map[string]types.TrustpilotLink
+	// EmbedTemplates maps a guild ID to its layout for review embeds
+	EmbedTemplates map[string]render.Template
+	// ReviewThreads maps a review ID to the threads it is being discussed in
+	ReviewThreads map[string][]types.ReviewThread
+	// Digests maps a channel ID to the reviews waiting for its next digest
+	Digests map[string]digest.Period
+	// ReplyReminders maps a review ID to how many reminders each channel has
+	// had about it, until it is replied to
+	ReplyReminders map[string]map[string]int
+	// LoginStates maps the state handed out by /login to the guild it was for
+	LoginStates map[string]LoginState `json:"-"`
+	// Searches maps the ID in /reviews page buttons to the search they page through
+	Searches map[string]SavedSearch `json:"-"`
+}
+
+// SavedSearch is a /reviews search whose results are still being paged through
+type SavedSearch struct {
+	Query     history.Query
+	ExpiresAt time.Time
+}
+
+// searchTTL is how long /reviews page buttons keep working
+const searchTTL = time.Hour
+
+// Create a global instance of our shared state
+var sharedState = SharedState{
+	StateArr:        []string{},
+	Routes:          []routing.Route{},
+	BusinessUnits:   []string{},
+	RecentReviews:   map[string][]render.Review{},
+	AllowedRoles:    map[string][]string{},
+	TrustpilotLinks: map[string]types.TrustpilotLink{},
+	EmbedTemplates:  map[string]render.Template{},
+	ReviewThreads:   map[string][]types.ReviewThread{},
+	Digests:         map[string]digest.Period{},
+	ReplyReminders:  map[string]map[string]int{},
+	LoginStates:     map[string]LoginState{},
+	Searches:        map[string]SavedSearch{},
+	history:         history.NewStore(),
+}
+
+// stateDocument is the name the shared state is saved under
+const stateDocument = "state"
+
+// tokensDocument is the name guilds' Trustpilot tokens are saved under,
+// apart from the state so it can be shared or backed up without them
+const tokensDocument = "tokens"
+
+// saveInterval is how often changes to the state are saved, so a burst of
+// webhooks costs one write rather than one each
+const saveInterval = 2 * time.Second
+
+// loadState restores the shared state saved in store and saves its changes
+// there whenever flush is called.
+func (s *SharedState) loadState(store *storage.Store) error {
+	s.Lock()
+	defer s.Unlock()
+	s.store = store
+
+	reviews, err := history.Open(store)
+	if err != nil {
+		return err
+	}
+	s.history = reviews
+
+	err = store.Load(stateDocument, s)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// A saved null would leave the maps unusable
+	if s.RecentReviews == nil {
+		s.RecentReviews = map[string][]render.Review{}
+	}
+	if s.AllowedRoles == nil {
+		s.AllowedRoles = map[string][]string{}
+	}
+	if s.TrustpilotLinks == nil {
+		s.TrustpilotLinks = map[string]types.TrustpilotLink{}
+	}
+	if s.EmbedTemplates == nil {
+		s.EmbedTemplates = map[string]render.Template{}
+	}
+	if s.ReviewThreads == nil {
+		s.ReviewThreads = map[string][]types.ReviewThread{}
+	}
+	if s.Digests == nil {
+		s.Digests = map[string]digest.Period{}
+	}
+	if s.ReplyReminders == nil {
+		s.ReplyReminders = map[string]map[string]int{}
+	}
+	// The history may have been trimmed as it was opened
+	s.pruneReminders()
+
+	// Channels picked before routes existed keep every review; their guild
+	// is filled in once the gateway says where they are
+	for _, channelID := range s.ChannelIDs {
+		if s.findRoute(channelID) < 0 {
+			s.Routes = append(s.Routes, routing.Route{ChannelID: channelID})
+		}
+	}
+	s.ChannelIDs = nil
+
+	// Routes from before they had a business unit get their guild's, if it
+	// has only one; the rest get no reviews until one is picked in /settings
+	for guildID := range s.TrustpilotLinks {
+		s.assignBusinessUnit(guildID)
+	}
+	for _, route := range s.Routes {
+		if route.BusinessUnitID == "" {
+			slog.Warn("review channel has no business unit, pick one in /settings", "guild_id", route.GuildID, "channel_id", route.ChannelID)
+		}
+	}
+	return s.loadTokens()
+}
+
+// assignBusinessUnit ties guildID's routes without a business unit to the
+// one its Trustpilot account can see, if it can see only one. It must be
+// called with the lock held.
+func (s *SharedState) assignBusinessUnit(guildID string) {
+	units := s.TrustpilotLinks[guildID].BusinessUnits
+	if len(units) != 1 {
+		return
+	}
+	for n, route := range s.Routes {
+		if route.GuildID == guildID && route.BusinessUnitID == "" {
+			s.Routes[n].BusinessUnitID = units[0].ID
+			slog.Info("tied review channel to business unit", "guild_id", guildID, "channel_id", route.ChannelID, "business_unit_id", units[0].ID)
+		}
+	}
+}
+
+// persist marks the state as changed, to be saved on the next flush. It
+// must be called with the lock held.
+func (s *SharedState) persist() {
+	s.dirty = true
+}
+
+// flush saves the state if it has changed since it was last saved.
+func (s *SharedState) flush() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.save()
+}
+
+// save saves the state without the Trustpilot tokens if it has changed. It
+// must be called with the lock held.
+func (s *SharedState) save() error {
+	if s.store == nil || !s.dirty {
+		return nil
+	}
+	links := s.TrustpilotLinks
+	s.TrustpilotLinks = make(map[string]types.TrustpilotLink, len(links))
+	for guildID, link := range links {
+		link.AccessToken = ""
+		s.TrustpilotLinks[guildID] = link
+	}
+	err := s.store.Save(stateDocument, s)
+	s.TrustpilotLinks = links
+	if err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Add helper methods to safely access and modify state
+func (s *SharedState) GetStateArr() []string {
+	s.RLock()
+	defer s.RUnlock()
+	// Return a copy to prevent race conditions
+	result := make([]string, len(s.StateArr))
+	copy(result, s.StateArr)
+	return result
+}
+
+// GetRoutes returns every route in every guild.
+func (s *SharedState) GetRoutes() []routing.Route {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]routing.Route, len(s.Routes))
+	copy(result, s.Routes)
+	return result
+}
+
+// GetGuildRoutes returns the routes to channels in guildID.
+func (s *SharedState) GetGuildRoutes(guildID string) []routing.Route {
+	s.RLock()
+	defer s.RUnlock()
+	var result []routing.Route
+	for _, route := range s.Routes {
+		if route.GuildID == guildID {
+			result = append(result, route)
+		}
+	}
+	return result
+}
+
+// findRoute returns the index of the route to channelID, or -1. It must be
+// called with the lock held.
+func (s *SharedState) findRoute(channelID string) int {
+	for n, route := range s.Routes {
+		if route.ChannelID == channelID {
+			return n
+		}
+	}
+	return -1
+}
+
+// AddRoutes starts delivering reviews along routes. Channels that already
+// have a route keep its settings, but get the business unit picked.
+func (s *SharedState) AddRoutes(routes ...routing.Route) {
+	s.Lock()
+	defer s.Unlock()
+	for _, route := range routes {
+		if n := s.findGuildRoute(route.GuildID, route.ChannelID); n >= 0 {
+			s.Routes[n].BusinessUnitID = route.BusinessUnitID
+			slog.Info("updated review channel", "guild_id", route.GuildID, "channel_id", route.ChannelID, "business_unit_id", route.BusinessUnitID)
+		} else if s.findRoute(route.ChannelID) < 0 {
+			s.Routes = append(s.Routes, route)
+			slog.Info("added review channel", "guild_id", route.GuildID, "channel_id", route.ChannelID, "business_unit_id", route.BusinessUnitID, "forum", route.Forum)
+		}
+	}
+	s.persist()
+}
+
+// SetRouteFilter sets the filter for channelID in guildID, reporting false
+// if there is no such route.
+func (s *SharedState) SetRouteFilter(guildID string, channelID string, filter routing.Filter) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 {
+		return false
+	}
+	s.Routes[n].Filter = filter
+	slog.Info("updated route filter", "guild_id", guildID, "channel_id", channelID, "filter", filter.String())
+	s.persist()
+	return true
+}
+
+// SetRouteGuild records which guild a route's channel is in, for routes
+// saved before that was known.
+func (s *SharedState) SetRouteGuild(channelID string, guildID string) {
+	s.Lock()
+	defer s.Unlock()
+	if n := s.findRoute(channelID); n >= 0 && s.Routes[n].GuildID == "" {
+		s.Routes[n].GuildID = guildID
+		s.persist()
+	}
+}
+
+// findGuildRoute returns the index of the route to channelID in guildID, or
+// -1. It must be called with the lock held.
+func (s *SharedState) findGuildRoute(guildID string, channelID string) int {
+	if n := s.findRoute(channelID); n >= 0 && s.Routes[n].GuildID == guildID {
+		return n
+	}
+	return -1
+}
+
+// AddMentionRule adds rule to the route to channelID in guildID, reporting
+// false if there is no such route.
+func (s *SharedState) AddMentionRule(guildID string, channelID string, rule routing.MentionRule) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 {
+		return false
+	}
+	rules := append([]routing.MentionRule{}, s.Routes[n].MentionRules...)
+	s.Routes[n].MentionRules = append(rules, rule)
+	slog.Info("added mention rule", "guild_id", guildID, "channel_id", channelID, "role_ids", rule.RoleIDs, "user_ids", rule.UserIDs)
+	s.persist()
+	return true
+}
+
+// RemoveMentionRule removes the index'th mention rule from the route to
+// channelID in guildID, reporting false if there is no such rule.
+func (s *SharedState) RemoveMentionRule(guildID string, channelID string, index int) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 || index < 0 || index >= len(s.Routes[n].MentionRules) {
+		return false
+	}
+	rules := append([]routing.MentionRule{}, s.Routes[n].MentionRules[:index]...)
+	s.Routes[n].MentionRules = append(rules, s.Routes[n].MentionRules[index+1:]...)
+	slog.Info("removed mention rule", "guild_id", guildID, "channel_id", channelID)
+	s.persist()
+	return true
+}
+
+// SetQuietHours sets when the route to channelID in guildID doesn't ping,
+// reporting false if there is no such route.
+func (s *SharedState) SetQuietHours(guildID string, channelID string, quiet routing.QuietHours) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 {
+		return false
+	}
+	s.Routes[n].QuietHours = quiet
+	slog.Info("updated quiet hours", "guild_id", guildID, "channel_id", channelID, "quiet_hours", quiet.String())
+	s.persist()
+	return true
+}
+
+// SetRouteThreads turns threads on reviews posted to channelID in guildID
+// on or off, reporting false if there is no such route.
+func (s *SharedState) SetRouteThreads(guildID string, channelID string, threads bool) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 {
+		return false
+	}
+	s.Routes[n].Threads = threads
+	slog.Info("updated review threads", "guild_id", guildID, "channel_id", channelID, "threads", threads)
+	s.persist()
+	return true
+}
+
+// SetRouteDigest sets when the route to channelID in guildID gets digests,
+// reporting false if there is no such route. Turning digests off drops the
+// reviews waiting for one.
+func (s *SharedState) SetRouteDigest(guildID string, channelID string, d routing.Digest) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 {
+		return false
+	}
+	s.Routes[n].Digest = d
+	if d.IsZero() {
+		delete(s.Digests, channelID)
+	} else if _, ok := s.Digests[channelID]; !ok {
+		s.Digests[channelID] = digest.Period{Since: time.Now()}
+	}
+	slog.Info("updated digest", "guild_id", guildID, "channel_id", channelID, "schedule", d.Schedule, "digest_only", d.Only)
+	s.persist()
+	return true
+}
+
+// SetRouteReplySLA sets when the route to channelID in guildID is reminded
+// about reviews without a reply, reporting false if there is no such route.
+func (s *SharedState) SetRouteReplySLA(guildID string, channelID string, sla routing.ReplySLA) bool {
+	s.Lock()
+	defer s.Unlock()
+	n := s.findGuildRoute(guildID, channelID)
+	if n < 0 {
+		return false
+	}
+	// Changing the reminders keeps when they were first turned on
+	if !sla.IsZero() && sla.Since.IsZero() {
+		sla.Since = s.Routes[n].ReplySLA.Since
+		if sla.Since.IsZero() {
+			sla.Since = time.Now()
+		}
+	}
+	s.Routes[n].ReplySLA = sla
+	slog.Info("updated reply SLA", "guild_id", guildID, "channel_id", channelID, "reply_sla", sla.String())
+	s.persist()
+	return true
+}
+
+// digestBufferLimit is how many reviews wait for a route's digest, after
+// which the oldest are dropped
+const digestBufferLimit = 1000
+
+// BufferDigestReview keeps review for channelID's next digest.
+func (s *SharedState) BufferDigestReview(channelID string, review render.Review) {
+	s.Lock()
+	defer s.Unlock()
+	period := s.Digests[channelID]
+	period.Reviews = append(period.Reviews, review)
+	if over := len(period.Reviews) - digestBufferLimit; over > 0 {
+		period.Reviews = append([]render.Review{}, period.Reviews[over:]...)
+	}
+	s.Digests[channelID] = period
+	s.persist()
+}
+
+// GetDigestPeriod returns the reviews waiting for channelID's next digest.
+func (s *SharedState) GetDigestPeriod(channelID string) digest.Period {
+	s.RLock()
+	defer s.RUnlock()
+	period := s.Digests[channelID]
+	period.Reviews = append([]render.Review{}, period.Reviews...)
+	return period
+}
+
+// CompleteDigest starts channelID's next period at now, once a digest of its
+// first posted reviews has gone out.
+func (s *SharedState) CompleteDigest(channelID string, now time.Time, posted int, summary digest.Summary) {
+	s.Lock()
+	defer s.Unlock()
+	period := s.Digests[channelID]
+	// Reviews may have come in while the digest was being sent
+	remaining := period.Reviews[min(posted, len(period.Reviews)):]
+	s.Digests[channelID] = digest.Period{
+		Since:    now,
+		Reviews:  append([]render.Review{}, remaining...),
+		Previous: summary,
+	}
+	s.persist()
+}
+
+// reviewThreadTTL is how long a thread is tracked waiting for a reply
+const reviewThreadTTL = 90 * 24 * time.Hour
+
+// AddReviewThread tracks a thread reviewID is being discussed in, so it can
+// be resolved when the review is replied to.
+func (s *SharedState) AddReviewThread(reviewID string, thread types.ReviewThread) {
+	s.Lock()
+	defer s.Unlock()
+	// Reviews that never get a reply would otherwise be tracked forever
+	for id, threads := range s.ReviewThreads {
+		threads = slices.DeleteFunc(threads, func(t types.ReviewThread) bool {
+			return time.Since(t.CreatedAt) > reviewThreadTTL
+		})
+		if len(threads) == 0 {
+			delete(s.ReviewThreads, id)
+		} else {
+			s.ReviewThreads[id] = threads
+		}
+	}
+	s.ReviewThreads[reviewID] = append(s.ReviewThreads[reviewID], thread)
+	s.persist()
+}
+
+// GetReviewThreads returns the threads reviewID is being discussed in.
+func (s *SharedState) GetReviewThreads(reviewID string) []types.ReviewThread {
+	s.RLock()
+	defer s.RUnlock()
+	return append([]types.ReviewThread{}, s.ReviewThreads[reviewID]...)
+}
+
+// RemoveReviewThread stops tracking threadID once it has been resolved.
+func (s *SharedState) RemoveReviewThread(reviewID string, threadID string) {
+	s.Lock()
+	defer s.Unlock()
+	threads := slices.DeleteFunc(append([]types.ReviewThread{}, s.ReviewThreads[reviewID]...), func(t types.ReviewThread) bool {
+		return t.ThreadID == threadID
+	})
+	if len(threads) == 0 {
+		delete(s.ReviewThreads, reviewID)
+	} else {
+		s.ReviewThreads[reviewID] = threads
+	}
+	s.persist()
+}
+
+// recentReviewLimit is how many reviews of each business unit are kept for
+// previewing filters
+const recentReviewLimit = 50
+
+// RecordReview keeps review in the history and for previewing its business
+// unit's filters against.
+func (s *SharedState) RecordReview(review render.Review) {
+	trimmed := s.history.Add(review)
+
+	s.Lock()
+	defer s.Unlock()
+	if trimmed {
+		s.pruneReminders()
+	}
+	if review.BusinessUnitID == "" {
+		return
+	}
+	recent := append(s.RecentReviews[review.BusinessUnitID], review)
+	if over := len(recent) - recentReviewLimit; over > 0 {
+		recent = append([]render.Review{}, recent[over:]...)
+	}
+	s.RecentReviews[review.BusinessUnitID] = recent
+	s.persist()
+}
+
+// GetRecentReviews returns up to n of the latest reviews of businessUnitID,
+// newest first.
+func (s *SharedState) GetRecentReviews(businessUnitID string, n int) []render.Review {
+	s.RLock()
+	defer s.RUnlock()
+	recent := s.RecentReviews[businessUnitID]
+	n = min(n, len(recent))
+	result := make([]render.Review, n)
+	for i := range result {
+		result[i] = recent[len(recent)-1-i]
+	}
+	return result
+}
+
+// SearchReviews returns the reviews in the history q picks out, newest first.
+func (s *SharedState) SearchReviews(q history.Query) []history.Record {
+	return s.history.Search(q)
+}
+
+// MarkReviewReplied records that reviewID has been replied to, which stops
+// its reminders.
+func (s *SharedState) MarkReviewReplied(reviewID string) {
+	if !s.history.MarkReplied(reviewID, time.Now()) {
+		slog.Debug("replied to a review missing from the history", "review_id", reviewID)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.ReplyReminders[reviewID]; ok {
+		delete(s.ReplyReminders, reviewID)
+		s.persist()
+	}
+}
+
+// pruneReminders forgets the reminders sent about reviews the history has
+// dropped, which are never reminded about again. It must be called with
+// the lock held.
+func (s *SharedState) pruneReminders() {
+	for reviewID := range s.ReplyReminders {
+		if _, ok := s.history.Get(reviewID); !ok {
+			delete(s.ReplyReminders, reviewID)
+			s.persist()
+		}
+	}
+}
+
+// ReminderLevel returns how many reminders channelID has had about reviewID.
+func (s *SharedState) ReminderLevel(channelID string, reviewID string) int {
+	s.RLock()
+	defer s.RUnlock()
+	return s.ReplyReminders[reviewID][channelID]
+}
+
+// SetReminderLevel records that channelID has had level reminders about reviewID.
+func (s *SharedState) SetReminderLevel(channelID string, reviewID string, level int) {
+	s.Lock()
+	defer s.Unlock()
+	if s.ReplyReminders[reviewID] == nil {
+		s.ReplyReminders[reviewID] = map[string]int{}
+	}
+	s.ReplyReminders[reviewID][channelID] = level
+	s.persist()
+}
+
+// SaveSearch keeps q for paging through its results, returning the ID to
+// find it again with.
+func (s *SharedState) SaveSearch(q history.Query) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	searchID := hex.EncodeToString(b)
+
+	s.Lock()
+	defer s.Unlock()
+	for key, saved := range s.Searches {
+		if time.Now().After(saved.ExpiresAt) {
+			delete(s.Searches, key)
+		}
+	}
+	s.Searches[searchID] = SavedSearch{Query: q, ExpiresAt: time.Now().Add(searchTTL)}
+	return searchID
+}
+
+// GetSearch returns the search saved under searchID, if it hasn't expired.
+func (s *SharedState) GetSearch(searchID string) (history.Query, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	saved, ok := s.Searches[searchID]
+	if !ok || time.Now().After(saved.ExpiresAt) {
+		return history.Query{}, false
+	}
+	return saved.Query, true
+}
+
+func (s *SharedState) GetBuids() []string {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]string, len(s.BusinessUnits))
+	copy(result, s.BusinessUnits)
+	return result
+}
+
+func (s *SharedState) GetAllowedRoles(guildID string) []string {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]string, len(s.AllowedRoles[guildID]))
+	copy(result, s.AllowedRoles[guildID])
+	return result
+}
+
+func (s *SharedState) SetAllowedRoles(guildID string, roleIDs ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.AllowedRoles[guildID] = append([]string{}, roleIDs...)
+	slog.Info("updated allowed roles", "guild_id", guildID, "role_ids", s.AllowedRoles[guildID])
+	s.persist()
+}
+
+// GetEmbedTemplate returns guildID's layout for review embeds, which is
+// empty, and so the default, if it hasn't set one.
+func (s *SharedState) GetEmbedTemplate(guildID string) render.Template {
+	s.RLock()
+	defer s.RUnlock()
+	return s.EmbedTemplates[guildID]
+}
+
+func (s *SharedState) SetEmbedTemplate(guildID string, t render.Template) {
+	s.Lock()
+	defer s.Unlock()
+	s.EmbedTemplates[guildID] = t
+	slog.Info("updated embed template", "guild_id", guildID)
+	s.persist()
+}
+
+func (s *SharedState) AppendToStateArr(values ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.StateArr = append(s.StateArr, values...)
+	slog.Info("updated selected business units", "business_units", s.StateArr)
+	s.persist()
+}
+
+// AppendToBuids adds the business unit names in values that aren't listed
+// yet, so logging in again doesn't list them twice.
+func (s *SharedState) AppendToBuids(values ...string) {
+	s.Lock()
+	defer s.Unlock()
+	added := false
+	for _, value := range values {
+		if !slices.Contains(s.BusinessUnits, value) {
+			s.BusinessUnits = append(s.BusinessUnits, value)
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	slog.Info("updated business units", "business_units", s.BusinessUnits)
+	s.persist()
+}
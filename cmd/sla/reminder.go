@@ -0,0 +1,188 @@
+// Package sla reminds routes about reviews left without a reply past their
+// deadlines, pinging more people the longer a review waits.
+package sla
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+// State is where the reminder finds routes, reviews and the reminders
+// already sent.
+type State interface {
+	GetRoutes() []routing.Route
+	SearchReviews(q history.Query) []history.Record
+	GetReviewThreads(reviewID string) []types.ReviewThread
+	// ReminderLevel is how many reminders channelID has had about reviewID
+	ReminderLevel(channelID string, reviewID string) int
+	SetReminderLevel(channelID string, reviewID string, level int)
+}
+
+// Queue is where reminders are sent from.
+type Queue interface {
+	Enqueue(m delivery.Message) error
+}
+
+// checkInterval is how often reviews are checked against their deadlines
+const checkInterval = time.Minute
+
+// escalationLevel is the reminder from which a review is escalated: its
+// route's escalation roles are pinged and its forum posts tagged as such
+const escalationLevel = 2
+
+// Reminder sends the reminders routes are due.
+type Reminder struct {
+	state State
+	queue Queue
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewReminder returns a reminder that sends through queue.
+func NewReminder(state State, queue Queue) *Reminder {
+	return &Reminder{
+		state: state,
+		queue: queue,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start checks for overdue reviews every minute in the background.
+func (r *Reminder) Start(ctx context.Context) error {
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case now := <-ticker.C:
+				r.RunDue(now)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops checking, waiting for a check in progress to finish.
+func (r *Reminder) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunDue sends the reminders due at now.
+func (r *Reminder) RunDue(now time.Time) {
+	for _, route := range r.state.GetRoutes() {
+		// Routes without a business unit get no reviews to remind about
+		if route.ReplySLA.IsZero() || route.BusinessUnitID == "" {
+			continue
+		}
+		unreplied := r.state.SearchReviews(history.Query{
+			Unreplied:       true,
+			MaxStars:        route.ReplySLA.MaxStars,
+			Since:           route.ReplySLA.Since,
+			BusinessUnitIDs: []string{route.BusinessUnitID},
+		})
+		for _, record := range unreplied {
+			if !route.Matches(record.Review) {
+				continue
+			}
+			level := route.ReplySLA.Level(now.Sub(record.CreatedAt))
+			if level == 0 || level <= r.state.ReminderLevel(route.ChannelID, record.ID) {
+				continue
+			}
+			if err := r.queue.Enqueue(r.reminder(route, record, level, now)); err != nil {
+				// It's sent on a later check instead
+				slog.Error("cannot queue reply reminder", "channel_id", route.ChannelID, "review_id", record.ID, "error", err)
+				return
+			}
+			r.state.SetReminderLevel(route.ChannelID, record.ID, level)
+			slog.Info("queued reply reminder", "channel_id", route.ChannelID, "review_id", record.ID, "level", level)
+			if level >= escalationLevel {
+				r.escalate(route, record.ID)
+			}
+		}
+	}
+}
+
+// escalate tags the review's forum posts in route's channel as escalated.
+func (r *Reminder) escalate(route routing.Route, reviewID string) {
+	for _, edit := range delivery.EscalateThreads(r.state.GetReviewThreads(reviewID), route.ChannelID) {
+		if err := r.queue.Enqueue(edit); err != nil {
+			// The reminder is out, which matters more than the tag
+			slog.Error("cannot queue escalated tag", "thread_id", edit.ChannelID, "review_id", reviewID, "error", err)
+		}
+	}
+}
+
+// reminder is the message reminding route about record, in the review's
+// thread when it has one.
+func (r *Reminder) reminder(route routing.Route, record history.Record, level int, now time.Time) delivery.Message {
+	mentions := reminderMentions(route, record.Review, level, now)
+
+	icon := "⏰"
+	if level > 1 {
+		icon = "⚠️"
+	}
+	title := "Untitled review"
+	if record.Title != "" {
+		title = render.Escape(render.Truncate(record.Title, 100))
+	}
+	content := fmt.Sprintf("%s %s **%s** has waited %s for a reply.", icon, record.StarBar(), title, routing.ShortDuration(now.Sub(record.CreatedAt)))
+	if record.URL != "" {
+		content += " <" + record.URL + ">"
+	}
+	if !mentions.IsZero() {
+		content = mentions.Content() + " " + content
+	}
+
+	channelID := route.ChannelID
+	for _, thread := range r.state.GetReviewThreads(record.ID) {
+		if thread.ChannelID == route.ChannelID {
+			channelID = thread.ThreadID
+		}
+	}
+	return delivery.Message{
+		ChannelID: channelID,
+		Send: &discordgo.MessageSend{
+			Content: render.Truncate(content, render.MaxContent),
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Roles: mentions.RoleIDs,
+				Users: mentions.UserIDs,
+			},
+		},
+	}
+}
+
+// reminderMentions are who the level'th reminder about review pings:
+// whoever the route pings about the review, and its escalation roles from
+// the second reminder on, all outside quiet hours.
+func reminderMentions(route routing.Route, review render.Review, level int, now time.Time) routing.Mentions {
+	mentions := route.Mentions(review, now)
+	if level < escalationLevel || route.QuietHours.Contains(now) {
+		return mentions
+	}
+	for _, roleID := range route.ReplySLA.EscalateRoleIDs {
+		if !slices.Contains(mentions.RoleIDs, roleID) {
+			mentions.RoleIDs = append(mentions.RoleIDs, roleID)
+		}
+	}
+	return mentions
+}
@@ -0,0 +1,134 @@
+package sla
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/delivery"
+	"github.com/liukaku/discord-tp/cmd/forum"
+	"github.com/liukaku/discord-tp/cmd/history"
+	"github.com/liukaku/discord-tp/cmd/render"
+	"github.com/liukaku/discord-tp/cmd/routing"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+type fakeState struct {
+	routes  []routing.Route
+	history *history.Store
+	threads map[string][]types.ReviewThread
+	levels  map[string]int
+}
+
+func (f *fakeState) GetRoutes() []routing.Route { return f.routes }
+
+func (f *fakeState) SearchReviews(q history.Query) []history.Record { return f.history.Search(q) }
+
+func (f *fakeState) GetReviewThreads(reviewID string) []types.ReviewThread {
+	return f.threads[reviewID]
+}
+
+func (f *fakeState) ReminderLevel(channelID string, reviewID string) int {
+	return f.levels[channelID+"/"+reviewID]
+}
+
+func (f *fakeState) SetReminderLevel(channelID string, reviewID string, level int) {
+	f.levels[channelID+"/"+reviewID] = level
+}
+
+type fakeQueue struct {
+	messages []delivery.Message
+}
+
+func (q *fakeQueue) Enqueue(m delivery.Message) error {
+	q.messages = append(q.messages, m)
+	return nil
+}
+
+func TestRunDue(t *testing.T) {
+	start := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	state := &fakeState{
+		routes: []routing.Route{{
+			ChannelID:      "support",
+			BusinessUnitID: "bu-1",
+			MentionRules:   []routing.MentionRule{{RoleIDs: []string{"support-team"}}},
+			ReplySLA: routing.ReplySLA{
+				Reminders:       []time.Duration{24 * time.Hour, 48 * time.Hour},
+				MaxStars:        2,
+				EscalateRoleIDs: []string{"managers"},
+				Since:           start,
+			},
+		}},
+		history: history.NewStore(),
+		threads: map[string][]types.ReviewThread{
+			"threaded": {{ChannelID: "support", ThreadID: "thread-1", Forum: true}, {ChannelID: "elsewhere", ThreadID: "post-2", Forum: true}},
+		},
+		levels: map[string]int{},
+	}
+	state.history.Add(render.Review{ID: "angry", BusinessUnitID: "bu-1", Stars: 1, Title: "Never arrived", URL: "https://example.com/angry", CreatedAt: start.Add(time.Hour)})
+	state.history.Add(render.Review{ID: "threaded", BusinessUnitID: "bu-1", Stars: 2, CreatedAt: start.Add(time.Hour)})
+	state.history.Add(render.Review{ID: "happy", BusinessUnitID: "bu-1", Stars: 5, CreatedAt: start.Add(time.Hour)})
+	state.history.Add(render.Review{ID: "replied", BusinessUnitID: "bu-1", Stars: 1, CreatedAt: start.Add(time.Hour)})
+	state.history.Add(render.Review{ID: "elsewhere", BusinessUnitID: "bu-2", Stars: 1, CreatedAt: start.Add(time.Hour)})
+	state.history.MarkReplied("replied", start.Add(2*time.Hour))
+	state.history.Add(render.Review{ID: "before", BusinessUnitID: "bu-1", Stars: 1, CreatedAt: start.Add(-time.Hour)})
+	queue := &fakeQueue{}
+	reminder := NewReminder(state, queue)
+
+	reminder.RunDue(start.Add(12 * time.Hour))
+	if len(queue.messages) != 0 {
+		t.Fatalf("reminded %d times before the first deadline", len(queue.messages))
+	}
+
+	reminder.RunDue(start.Add(26 * time.Hour))
+	reminder.RunDue(start.Add(27 * time.Hour))
+	if len(queue.messages) != 2 {
+		t.Fatalf("got %d first reminders, want one each for the two low reviews", len(queue.messages))
+	}
+	sentTo := map[string]string{}
+	for _, m := range queue.messages {
+		sentTo[m.ChannelID] = m.Send.Content
+	}
+	first := sentTo["support"]
+	if !strings.HasPrefix(first, "<@&support-team> ⏰ ★☆☆☆☆ **Never arrived** has waited 1d 1h") || !strings.Contains(first, "<https://example.com/angry>") {
+		t.Errorf("got first reminder %q", first)
+	}
+	if _, ok := sentTo["thread-1"]; !ok {
+		t.Errorf("threaded review not reminded in its thread, sent to %v", sentTo)
+	}
+
+	queue.messages = nil
+	reminder.RunDue(start.Add(50 * time.Hour))
+	var reminders, retagged []delivery.Message
+	for _, m := range queue.messages {
+		if m.ThreadEdit != nil {
+			retagged = append(retagged, m)
+		} else {
+			reminders = append(reminders, m)
+		}
+	}
+	if len(reminders) != 2 {
+		t.Fatalf("got %d second reminders, want 2", len(reminders))
+	}
+	if len(retagged) != 1 || retagged[0].ChannelID != "thread-1" || retagged[0].ThreadEdit.Status != forum.StatusEscalated {
+		t.Errorf("got forum edits %+v, want thread-1 tagged as escalated", retagged)
+	}
+	escalated := reminders[0].Send
+	if !strings.Contains(escalated.Content, "⚠️") || len(escalated.AllowedMentions.Roles) != 2 || escalated.AllowedMentions.Roles[1] != "managers" {
+		t.Errorf("got second reminder %q pinging %v", escalated.Content, escalated.AllowedMentions.Roles)
+	}
+}
+
+func TestReminderMentionsRespectQuietHours(t *testing.T) {
+	route := routing.Route{
+		QuietHours: routing.QuietHours{Start: "22:00", End: "07:00"},
+		ReplySLA:   routing.ReplySLA{EscalateRoleIDs: []string{"managers"}},
+	}
+	night := time.Date(2024, 6, 3, 23, 0, 0, 0, time.UTC)
+	if got := reminderMentions(route, render.Review{Stars: 1}, 2, night); !got.IsZero() {
+		t.Errorf("pinged %+v during quiet hours", got)
+	}
+	if got := reminderMentions(route, render.Review{Stars: 1}, 2, night.Add(10*time.Hour)); len(got.RoleIDs) != 1 {
+		t.Errorf("got %+v during the day", got)
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound is returned by Load when nothing has been saved under a name yet.
+var ErrNotFound = errors.New("not found")
+
+// Store keeps JSON documents as files in a directory. Saves replace the
+// whole document atomically, so a crash never leaves half a file behind.
+// Logs are appended to a line at a time instead, for data that grows with
+// every webhook and would be too costly to rewrite each time.
+type Store struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// Open returns a store keeping its files in dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Load decodes the document saved under name into v.
+func (s *Store) Load(name string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save replaces the document saved under name with v.
+func (s *Store) Save(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(s.path(name), data)
+}
+
+func (s *Store) logPath(name string) string {
+	return filepath.Join(s.dir, name+".jsonl")
+}
+
+// Append adds v to the end of the log saved under name, leaving what is
+// already there alone.
+func (s *Store) Append(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.logPath(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", name, err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("error appending to %s: %w", name, err)
+	}
+	return f.Close()
+}
+
+// ReadLog calls fn with each entry of the log saved under name, oldest
+// first. An entry cut short by a crash is skipped.
+func (s *Store) ReadLog(name string, fn func(entry json.RawMessage) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.logPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Whatever is left never got its newline
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", name, err)
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || !json.Valid(line) {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("error parsing %s: %w", name, err)
+		}
+	}
+}
+
+// ReplaceLog replaces the log saved under name with entries, atomically.
+func (s *Store) ReplaceLog(name string, entries []any) error {
+	var data bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("error encoding %s: %w", name, err)
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(s.logPath(name), data.Bytes())
+}
+
+func (s *Store) write(path string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Ping checks the store can still be written to.
+func (s *Store) Ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	probe := filepath.Join(s.dir, ".ping")
+	if err := s.write(probe, []byte("{}")); err != nil {
+		return err
+	}
+	return os.Remove(probe)
+}
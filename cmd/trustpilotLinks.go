@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/server/types"
+	"github.com/liukaku/discord-tp/cmd/storage"
+)
+
+// LoginState is an outstanding /login waiting for Trustpilot to redirect back
+type LoginState struct {
+	GuildID   string
+	ExpiresAt time.Time
+}
+
+// loginStateTTL is how long a /login link stays valid
+const loginStateTTL = 15 * time.Minute
+
+// loadTokens restores the Trustpilot tokens saved apart from the state,
+// moving any still saved in it out. It must be called with the lock held.
+func (s *SharedState) loadTokens() error {
+	tokens := map[string]string{}
+	err := s.store.Load(tokensDocument, &tokens)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	var moved int
+	for guildID, link := range s.TrustpilotLinks {
+		if token, ok := tokens[guildID]; ok {
+			link.AccessToken = token
+			s.TrustpilotLinks[guildID] = link
+		} else if link.AccessToken != "" {
+			moved++
+		}
+	}
+	if moved == 0 {
+		return nil
+	}
+	if err := s.saveTokens(); err != nil {
+		return err
+	}
+	slog.Info("moved Trustpilot tokens out of the saved state", "guilds", moved)
+	s.persist()
+	return s.save()
+}
+
+// saveTokens saves every guild's Trustpilot token. Tokens change only on
+// /login, so they are saved straight away rather than on the next flush.
+// It must be called with the lock held.
+func (s *SharedState) saveTokens() error {
+	if s.store == nil {
+		return nil
+	}
+	tokens := make(map[string]string, len(s.TrustpilotLinks))
+	for guildID, link := range s.TrustpilotLinks {
+		tokens[guildID] = link.AccessToken
+	}
+	return s.store.Save(tokensDocument, tokens)
+}
+
+func (s *SharedState) GetTrustpilotLink(guildID string) (types.TrustpilotLink, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	link, ok := s.TrustpilotLinks[guildID]
+	return link, ok
+}
+
+func (s *SharedState) SetTrustpilotLink(guildID string, link types.TrustpilotLink) {
+	s.Lock()
+	defer s.Unlock()
+	s.TrustpilotLinks[guildID] = link
+	if err := s.saveTokens(); err != nil {
+		slog.Error("cannot save Trustpilot tokens", "guild_id", guildID, "error", err)
+	}
+	slog.Info("linked Trustpilot business user", "guild_id", guildID, "business_user_id", link.BusinessUserID, "business_units", len(link.BusinessUnits), "expires_at", link.ExpiresAt)
+	s.assignBusinessUnit(guildID)
+	s.persist()
+}
+
+// GetBusinessUnits returns every business unit linked in any guild, once each.
+func (s *SharedState) GetBusinessUnits() []types.LinkedBusinessUnit {
+	s.RLock()
+	defer s.RUnlock()
+	var result []types.LinkedBusinessUnit
+	for _, link := range s.TrustpilotLinks {
+		for _, unit := range link.BusinessUnits {
+			if !slices.ContainsFunc(result, func(u types.LinkedBusinessUnit) bool { return u.ID == unit.ID }) {
+				result = append(result, unit)
+			}
+		}
+	}
+	return result
+}
+
+// CreateLoginState returns an unguessable state for a /login link in guildID
+func (s *SharedState) CreateLoginState(guildID string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	loginState := hex.EncodeToString(b)
+
+	s.Lock()
+	defer s.Unlock()
+	for key, pending := range s.LoginStates {
+		if time.Now().After(pending.ExpiresAt) {
+			delete(s.LoginStates, key)
+		}
+	}
+	s.LoginStates[loginState] = LoginState{GuildID: guildID, ExpiresAt: time.Now().Add(loginStateTTL)}
+	return loginState
+}
+
+// ConsumeLoginState returns the guild a login state was created for. Each
+// state can only be used once.
+func (s *SharedState) ConsumeLoginState(loginState string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	pending, ok := s.LoginStates[loginState]
+	delete(s.LoginStates, loginState)
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		return "", false
+	}
+	return pending.GuildID, true
+}
@@ -0,0 +1,236 @@
+// Package trustpilottest provides a fake Trustpilot API, built on httptest,
+// that serves fixtures, records review replies and can fail on demand. It
+// can also send webhooks with the basic auth credentials Trustpilot sends,
+// so the whole flow from /login to a posted review can be tested offline.
+package trustpilottest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/liukaku/discord-tp/cmd/server/handlers/utils"
+	"github.com/liukaku/discord-tp/cmd/server/types"
+)
+
+// AccessToken is the only bearer token the fake accepts.
+const AccessToken = "tpa-test-token"
+
+// Reply is a review reply the fake received.
+type Reply struct {
+	ReviewID             string
+	AuthorBusinessUserID string
+	Message              string
+}
+
+// Server is a fake Trustpilot API. The exported fixtures may be changed
+// before requests are made.
+type Server struct {
+	*httptest.Server
+
+	// BusinessUser is returned by /v1/private/me
+	BusinessUser types.BusinessUser
+	// BusinessUnits are listed for BusinessUser and served by ID
+	BusinessUnits []types.BusinessUnitDetails
+
+	mu       sync.Mutex
+	failures map[string][]int
+	replies  []Reply
+}
+
+// NewServer starts a fake with one business user owning one business unit.
+// It is closed when the test ends.
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		BusinessUser: types.BusinessUser{ID: "business-user-1", Name: "Test User", Locale: "en-GB"},
+		BusinessUnits: []types.BusinessUnitDetails{{
+			ID:              "business-unit-1",
+			DisplayName:     "Acme",
+			Score:           types.Score{Stars: 4.5, TrustScore: 4.4},
+			NumberOfReviews: types.ReviewCount{Total: 120, FiveStars: 90, FourStars: 20, ThreeStars: 5, TwoStars: 3, OneStar: 2},
+		}},
+		failures: map[string][]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/private/me", s.me)
+	mux.HandleFunc("GET /v1/private/business-users/{id}/business-units", s.businessUnits)
+	mux.HandleFunc("GET /v1/private/business-units/{id}", s.businessUnit)
+	mux.HandleFunc("POST /v1/private/reviews/{id}/reply", s.reply)
+	s.Server = httptest.NewServer(s.withFailures(mux))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// FailNext makes the next requests to path fail with statuses, one per
+// request. A 429 carries a Retry-After header.
+func (s *Server) FailNext(path string, statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], statuses...)
+}
+
+// Replies returns the review replies received so far.
+func (s *Server) Replies() []Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Reply{}, s.replies...)
+}
+
+func (s *Server) withFailures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		var status int
+		if pending := s.failures[r.URL.Path]; len(pending) > 0 {
+			status, s.failures[r.URL.Path] = pending[0], pending[1:]
+		}
+		s.mu.Unlock()
+
+		switch {
+		case status == http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too Many Requests", status)
+		case status != 0:
+			http.Error(w, http.StatusText(status), status)
+		case r.Header.Get("Authorization") != "Bearer "+AccessToken:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, types.UserResponse{BusinessUser: s.BusinessUser})
+}
+
+func (s *Server) businessUnits(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != s.BusinessUser.ID {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	var response types.BusinessUnitsResponse
+	for _, bu := range s.BusinessUnits {
+		response.BusinessUnits = append(response.BusinessUnits, types.BusinessUnit{ID: bu.ID})
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) businessUnit(w http.ResponseWriter, r *http.Request) {
+	for _, bu := range s.BusinessUnits {
+		if bu.ID == r.PathValue("id") {
+			writeJSON(w, bu)
+			return
+		}
+	}
+	http.Error(w, "Not Found", http.StatusNotFound)
+}
+
+func (s *Server) reply(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		AuthorBusinessUserID string `json:"authorBusinessUserId"`
+		Message              string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Message == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if body.AuthorBusinessUserID != s.BusinessUser.ID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	s.replies = append(s.replies, Reply{ReviewID: r.PathValue("id"), AuthorBusinessUserID: body.AuthorBusinessUserID, Message: body.Message})
+	s.mu.Unlock()
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// Review describes a review for a webhook. Link is filled in to point at
+// the fake when left empty.
+type Review struct {
+	ID           string
+	Title        string
+	Text         string
+	Stars        int
+	Language     string
+	IsVerified   bool
+	ConsumerName string
+	Tags         map[string]string
+	CreatedAt    time.Time
+	Link         string
+}
+
+// ReviewWebhook returns the body Trustpilot sends when reviews are created.
+func (s *Server) ReviewWebhook(reviews ...Review) []byte {
+	type tag struct {
+		Group string `json:"group"`
+		Value string `json:"value"`
+	}
+	type event struct {
+		EventName string         `json:"eventName"`
+		Version   string         `json:"version"`
+		EventData map[string]any `json:"eventData"`
+	}
+
+	var events []event
+	for _, review := range reviews {
+		if review.Link == "" {
+			review.Link = s.URL + "/v1/reviews/" + review.ID
+		}
+		if review.CreatedAt.IsZero() {
+			review.CreatedAt = time.Now().UTC()
+		}
+		var tags []tag
+		for group, value := range review.Tags {
+			tags = append(tags, tag{group, value})
+		}
+		events = append(events, event{
+			EventName: "service-review-created",
+			Version:   "1.0",
+			EventData: map[string]any{
+				"id":         review.ID,
+				"language":   review.Language,
+				"title":      review.Title,
+				"text":       review.Text,
+				"stars":      review.Stars,
+				"createdAt":  review.CreatedAt,
+				"isVerified": review.IsVerified,
+				"link":       review.Link,
+				"consumer":   map[string]string{"id": "consumer-" + review.ID, "name": review.ConsumerName},
+				"tags":       tags,
+			},
+		})
+	}
+
+	body, _ := json.Marshal(map[string]any{"events": events})
+	return body
+}
+
+// SendWebhook posts body to url, with secret as its basic auth password
+// unless it is empty, as Trustpilot does with a webhook URL's credentials.
+func SendWebhook(url string, secret string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.SetBasicAuth(utils.WebhookUser, secret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending webhook: %w", err)
+	}
+	return resp, nil
+}